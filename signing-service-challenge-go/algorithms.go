@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+// signerFactory registers a Signer for every supported algorithm.
+func signerFactory() service.AlgorithmFactory {
+	factory := service.NewAlgorithmFactoryV0()
+
+	rsaSigner := func(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+		m := crypto.NewRSAMarshaller()
+		keyPairRaw, err := m.UnMarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, ok := keyPairRaw.(*crypto.RSAKeyPair)
+		if !ok {
+			return nil, ErrWrongType
+		}
+
+		return crypto.NewRSASigner(keyPair, signerConfig(device)), nil
+	}
+	factory.Add(domain.RSAPKCS1SHA256, rsaSigner)
+	factory.Add(domain.RSAPSSSHA256, rsaSigner)
+
+	factory.Add(domain.ECDSA, func(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+		m := crypto.NewECCMarshaller()
+		keyPairRaw, err := m.UnMarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, ok := keyPairRaw.(*crypto.ECCKeyPair)
+		if !ok {
+			return nil, ErrWrongType
+		}
+
+		return crypto.NewECCSigner(keyPair, signerConfig(device)), nil
+	})
+
+	factory.Add(domain.Ed25519, func(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+		m := crypto.NewEd25519Marshaller()
+		keyPairRaw, err := m.UnMarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, ok := keyPairRaw.(*crypto.Ed25519KeyPair)
+		if !ok {
+			return nil, ErrWrongType
+		}
+
+		return crypto.NewEd25519Signer(keyPair), nil
+	})
+
+	return factory
+}
+
+// verifierFactory registers a Verifier for every supported algorithm.
+func verifierFactory() service.VerifierFactory {
+	factory := service.NewVerifierFactoryV0()
+
+	rsaVerifier := func(device domain.Device, publicKey []byte) (crypto.Verifier, error) {
+		keyPairRaw, err := crypto.NewRSAMarshaller().UnMarshalPublic(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, ok := keyPairRaw.(*crypto.RSAKeyPair)
+		if !ok {
+			return nil, ErrWrongType
+		}
+
+		return crypto.NewRSAVerifier(keyPair, signerConfig(device)), nil
+	}
+	factory.Add(domain.RSAPKCS1SHA256, rsaVerifier)
+	factory.Add(domain.RSAPSSSHA256, rsaVerifier)
+
+	factory.Add(domain.ECDSA, func(device domain.Device, publicKey []byte) (crypto.Verifier, error) {
+		keyPairRaw, err := crypto.NewECCMarshaller().UnMarshalPublic(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, ok := keyPairRaw.(*crypto.ECCKeyPair)
+		if !ok {
+			return nil, ErrWrongType
+		}
+
+		return crypto.NewECCVerifier(keyPair, signerConfig(device)), nil
+	})
+
+	factory.Add(domain.Ed25519, func(device domain.Device, publicKey []byte) (crypto.Verifier, error) {
+		keyPairRaw, err := crypto.NewEd25519Marshaller().UnMarshalPublic(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keyPair, ok := keyPairRaw.(*crypto.Ed25519KeyPair)
+		if !ok {
+			return nil, ErrWrongType
+		}
+
+		return crypto.NewEd25519Verifier(keyPair), nil
+	})
+
+	return factory
+}
+
+// signerConfig maps the signature scheme and encoding of the device to the crypto config.
+func signerConfig(device domain.Device) crypto.Config {
+	config := crypto.Config{
+		RSAScheme:     crypto.RSAPKCS1v15,
+		ECDSAEncoding: crypto.ECDSAEncodingDER,
+	}
+	if device.Algorithm == domain.RSAPSSSHA256 {
+		config.RSAScheme = crypto.RSAPSS
+	}
+	if device.Encoding == domain.EncodingP1363 {
+		config.ECDSAEncoding = crypto.ECDSAEncodingP1363
+	}
+
+	return config
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// MigrateDeviceRequest creates a device that continues the signature chain of a device of another system.
+// Without PrivateKey the device gets a new key, the chain continues with signatures of that key.
+type MigrateDeviceRequest struct {
+	CreateSignatureDevice
+	// SignatureCounter is the counter of the first signature this service creates for the device.
+	SignatureCounter int64 `json:"signature_counter" validate:"gte=1"`
+	// LastSignature is the base64 encoded last signature of the migrated device.
+	LastSignature string `json:"last_signature" validate:"required,base64"`
+}
+
+// AuditRecordResponse is an administrative change of a device.
+type AuditRecordResponse struct {
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"`
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"`
+}
+
+// adminActorKey is the context key of the name of the authenticated admin.
+type adminActorKey struct{}
+
+// ParseAdminTokens parses comma separated name:token pairs, the name is recorded as actor in the audit trail.
+// Errors only name the position of an entry, they are logged and must not contain a token.
+func ParseAdminTokens(spec string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	names := make(map[string]string)
+	for i, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("admin token entry %d isn't a name:token pair", i+1)
+		}
+		name, token := parts[0], parts[1]
+		if _, ok := tokens[name]; ok {
+			return nil, fmt.Errorf("admin token entry %d repeats the name %q", i+1, name)
+		}
+		// a token shared by two names would make the recorded actor ambiguous
+		if other, ok := names[token]; ok {
+			return nil, fmt.Errorf("admin token entry %d repeats the token of %q", i+1, other)
+		}
+		tokens[name] = token
+		names[token] = name
+	}
+
+	return tokens, nil
+}
+
+// EnableAdmin serves the admin routes to requests with one of the bearer tokens, which are keyed by the
+// name of their admin. The routes are forbidden without tokens.
+func (s *Server) EnableAdmin(tokens map[string]string) {
+	s.adminTokens = make(map[string]string, len(tokens))
+	for name, token := range tokens {
+		s.adminTokens[name] = token
+	}
+}
+
+// admin only passes requests with an admin bearer token on to handler, the name of the admin is the
+// actor of the request.
+func (s *Server) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if len(s.adminTokens) == 0 {
+			WriteErrorResponse(response, http.StatusForbidden, []string{
+				"admin API is disabled",
+			})
+
+			return
+		}
+
+		actor, ok := s.authenticateAdmin(request.Header.Get("Authorization"))
+		if !ok {
+			log.Printf("[WARN][Admin] unauthorized request %s %s", request.Method, request.URL.Path)
+			response.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			WriteErrorResponse(response, http.StatusUnauthorized, []string{
+				http.StatusText(http.StatusUnauthorized),
+			})
+
+			return
+		}
+
+		handler(response, request.WithContext(context.WithValue(request.Context(), adminActorKey{}, actor)))
+	}
+}
+
+// authenticateAdmin returns the name of the admin with the bearer token of the Authorization header.
+// Every token is compared, so the time taken doesn't tell which one matched.
+func (s *Server) authenticateAdmin(authorization string) (string, bool) {
+	const scheme = "Bearer "
+	if len(authorization) <= len(scheme) || !strings.EqualFold(authorization[:len(scheme)], scheme) {
+		return "", false
+	}
+	token := []byte(authorization[len(scheme):])
+
+	var actor string
+	for name, adminToken := range s.adminTokens {
+		if subtle.ConstantTimeCompare(token, []byte(adminToken)) == 1 {
+			actor = name
+		}
+	}
+
+	return actor, actor != ""
+}
+
+// adminActor returns the name of the admin that sent the request through the admin guard.
+func adminActor(request *http.Request) string {
+	actor, _ := request.Context().Value(adminActorKey{}).(string)
+
+	return actor
+}
+
+// MigrateDevice creates a device that resumes the signature chain of a device of another system
+func (s *Server) MigrateDevice(response http.ResponseWriter, request *http.Request) {
+	var migration MigrateDeviceRequest
+	if !s.decodeRequest(response, request, "MigrateDevice", &migration) {
+		return
+	}
+
+	// the validator accepted the encoding
+	lastSignature, _ := base64.StdEncoding.DecodeString(migration.LastSignature)
+
+	res, err := s.signature.MigrateDevice(request.Context(), domain.DeviceMigration{
+		Device:     migration.ConvertToDomain(),
+		PrivateKey: domain.SecretKey(migration.PrivateKey),
+		Passphrase: domain.SecretKey(migration.Passphrase),
+		Chain: domain.ChainStart{
+			Counter:       migration.SignatureCounter,
+			LastSignature: lastSignature,
+		},
+		Actor: adminActor(request),
+	})
+	if err != nil {
+		log.Println("[WARN][MigrateDevice] error", err)
+		if errors.Is(err, domain.ErrInvalidChainStart) || errors.Is(err, domain.ErrEncodingNotAllowed) ||
+			errors.Is(err, domain.ErrKeyParamsNotAllowed) || errors.Is(err, domain.ErrKeyStorageNotAvailable) ||
+			errors.Is(err, domain.ErrKeyStorageAlgorithm) || errors.Is(err, domain.ErrKeyAlgorithmMismatch) ||
+			isInvalidImport(err) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+
+			return
+		}
+		if errors.Is(err, domain.ErrDeviceAlreadyExist) {
+			WriteErrorResponse(response, http.StatusConflict, []string{
+				domain.ErrDeviceAlreadyExist.Error(),
+			})
+
+			return
+		}
+		WriteInternalError(response)
+
+		return
+	}
+
+	response.Header().Set("Location", "/api/v0/devices/"+res.String())
+	WriteAPIResponse(response, http.StatusCreated, struct {
+		ID uuid.UUID `json:"id"`
+	}{
+		ID: res,
+	})
+}
+
+// GetAuditTrail returns the administrative changes of a device, oldest first
+func (s *Server) GetAuditTrail(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	trail, err := s.signature.AuditTrail(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "GetAuditTrail", err)
+
+		return
+	}
+
+	res := make([]AuditRecordResponse, 0, len(trail))
+	for _, record := range trail {
+		res = append(res, AuditRecordResponse{
+			Action: string(record.Action),
+			Actor:  record.Actor,
+			Detail: record.Detail,
+			At:     record.At,
+		})
+	}
+
+	WriteAPIResponse(response, http.StatusOK, res)
+}
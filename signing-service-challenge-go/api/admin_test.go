@@ -0,0 +1,148 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestServer_Admin(t *testing.T) {
+	t.Parallel()
+
+	deviceID := uuid.New()
+	migration := func() *http.Request {
+		body := fmt.Sprintf(`{"id": %q, "algorithm": "ECC", "signature_counter": 50, "last_signature": "c2lnNDk="}`, deviceID)
+
+		return httptest.NewRequest(http.MethodPost, "/api/v0/admin/devices/migrations", strings.NewReader(body))
+	}
+
+	disabled, _ := newServer()
+	if res := serve(disabled, migration()); res.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d without admin tokens, got %d", http.StatusForbidden, res.Code)
+	}
+
+	server, signature := newServer()
+	server.EnableAdmin(map[string]string{"alice": "alice-token", "bob": "bob-token"})
+
+	for _, authorization := range []string{"", "Bearer wrong", "alice-token", "Basic alice-token", "Bearer "} {
+		request := migration()
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		res := serve(server, request)
+		if res.Code != http.StatusUnauthorized || res.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("Authorization %q: expected status %d with a challenge, got %d", authorization, http.StatusUnauthorized, res.Code)
+		}
+	}
+
+	request := migration()
+	request.Header.Set("Authorization", "Bearer bob-token")
+	res := serve(server, request)
+	if res.Code != http.StatusCreated || res.Header().Get("Location") != "/api/v0/devices/"+deviceID.String() {
+		t.Fatalf("expected status %d with the device location, got %d: %s", http.StatusCreated, res.Code, res.Body)
+	}
+
+	details, err := signature.GetDevice(request.Context(), deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Status != domain.StatusActive || details.SignatureCounter != 50 {
+		t.Fatalf("expected an active device resuming at counter 50, got %+v", details)
+	}
+
+	// the actor of the audit trail is the admin of the token
+	audit := httptest.NewRequest(http.MethodGet, "/api/v0/admin/devices/"+deviceID.String()+"/audit", nil)
+	audit.Header.Set("Authorization", "Bearer alice-token")
+	res = serve(server, audit)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	var trail struct {
+		Data []api.AuditRecordResponse `json:"data"`
+	}
+	if err = json.Unmarshal(res.Body.Bytes(), &trail); err != nil {
+		t.Fatal(err)
+	}
+	if len(trail.Data) != 1 || trail.Data[0].Action != string(domain.AuditDeviceMigrated) || trail.Data[0].Actor != "bob" {
+		t.Fatalf("unexpected audit trail %+v", trail.Data)
+	}
+
+	unknown := httptest.NewRequest(http.MethodGet, "/api/v0/admin/devices/"+uuid.New().String()+"/audit", nil)
+	unknown.Header.Set("Authorization", "Bearer alice-token")
+	if res = serve(server, unknown); res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for an unknown device, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func TestServer_RotateKey(t *testing.T) {
+	t.Parallel()
+
+	server, signature := newServer()
+	deviceID, err := signature.CreateDevice(context.Background(), domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotate := func(authorization string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/"+deviceID.String()+"/keys:rotate", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+
+		return serve(server, request)
+	}
+
+	if res := rotate("Bearer carol-token"); res.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d without admin tokens, got %d", http.StatusForbidden, res.Code)
+	}
+
+	server.EnableAdmin(map[string]string{"carol": "carol-token"})
+	if res := rotate(""); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without a token, got %d", http.StatusUnauthorized, res.Code)
+	}
+	if res := rotate("Bearer carol-token"); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body)
+	}
+
+	trail, err := signature.AuditTrail(context.Background(), deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 1 || trail[0].Action != domain.AuditKeyRotated || trail[0].Actor != "carol" {
+		t.Fatalf("unexpected audit trail %+v", trail)
+	}
+}
+
+func TestParseAdminTokens(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := api.ParseAdminTokens(" alice:a:b , bob:secret,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens["alice"] != "a:b" || tokens["bob"] != "secret" {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+
+	for _, spec := range []string{"alice", "alice:", ":secret", "alice:secret,alice:other", "alice:secret,bob:secret"} {
+		if _, err = api.ParseAdminTokens(spec); err == nil {
+			t.Fatalf("%q: expected an error", spec)
+		}
+	}
+
+	// an entry without a name is only reported by its position, its token isn't logged
+	_, err = api.ParseAdminTokens("alice:a,s3cr3t-token")
+	if err == nil || strings.Contains(err.Error(), "s3cr3t-token") || !strings.Contains(err.Error(), "entry 2") {
+		t.Fatalf("expected an error naming entry 2 without the token, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// ChainExportResponse is the signature chain of a device as a self-contained document.
+// The verify-chain command checks it offline.
+type ChainExportResponse struct {
+	ChainExportHead
+	Entries []JournalEntryResponse `json:"entries"`
+}
+
+// ChainExportHead is the device and its public keys, the part of a chain export written ahead of the entries.
+type ChainExportHead struct {
+	Device DeviceResponse `json:"device"`
+	// PublicKey is the PEM encoded PKIX public key of the current key version of the device.
+	PublicKey string `json:"public_key"`
+	// PublicKeys are the PEM encoded PKIX public keys of all key versions, ordered by version.
+	// Exports of services without key rotation only have PublicKey.
+	PublicKeys       []ExportedKeyResponse `json:"public_keys"`
+	SignatureCounter int64                 `json:"signature_counter"`
+}
+
+// ExportedKeyResponse is the public key of a key version of an exported device.
+type ExportedKeyResponse struct {
+	KeyVersion int    `json:"key_version"`
+	PublicKey  string `json:"public_key"`
+}
+
+// VerifyChain checks the signature chain of a device and reports the first broken link
+func (s *Server) VerifyChain(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	report, err := s.signature.VerifyChain(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "VerifyChain", err)
+
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, report)
+}
+
+// ExportChain returns the signature chain of a device as downloadable document.
+// The entries are streamed from the journal, so the export of a long chain isn't held in memory.
+func (s *Server) ExportChain(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	export, err := s.signature.ExportChain(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "ExportChain", err)
+
+		return
+	}
+
+	head, err := json.MarshalIndent(ToChainExportHead(export), "", "  ")
+	if err != nil {
+		WriteInternalError(response)
+
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", deviceID.String()+"-chain.json"))
+	response.WriteHeader(http.StatusOK)
+
+	// the head object is left open and continued with the entries array
+	writer := bufio.NewWriter(response)
+	writer.Write(bytes.TrimSuffix(head, []byte("\n}"))) //nolint:errcheck
+	writer.WriteString(",\n  \"entries\": [")           //nolint:errcheck
+
+	var entry bytes.Buffer
+	encoder := json.NewEncoder(&entry)
+	encoder.SetIndent("    ", "  ")
+	separator := "\n    "
+	err = s.signature.WalkChain(request.Context(), export, func(journalEntry domain.JournalEntry) error {
+		entry.Reset()
+		if errEncode := encoder.Encode(ToJournalEntryResponse(journalEntry)); errEncode != nil {
+			return errEncode
+		}
+
+		writer.WriteString(separator) //nolint:errcheck
+		separator = ",\n    "
+		_, errWrite := writer.Write(bytes.TrimSuffix(entry.Bytes(), []byte("\n")))
+
+		return errWrite
+	})
+	if err != nil {
+		// the status is sent already, the truncated document doesn't parse
+		log.Println("[WARN][ExportChain] error", err)
+
+		return
+	}
+
+	if export.SignatureCounter > 0 {
+		writer.WriteString("\n  ") //nolint:errcheck
+	}
+	writer.WriteString("]\n}\n") //nolint:errcheck
+	if err = writer.Flush(); err != nil {
+		log.Println("[WARN][ExportChain] error", err)
+	}
+}
+
+// ToChainExportHead converts the device and the public keys of domain.ChainExport to ChainExportHead
+func ToChainExportHead(export domain.ChainExport) ChainExportHead {
+	res := ChainExportHead{
+		Device:           ToDeviceResponse(export.Device),
+		PublicKey:        string(export.PublicKeys[export.Device.KeyVersion]),
+		PublicKeys:       make([]ExportedKeyResponse, 0, len(export.PublicKeys)),
+		SignatureCounter: export.SignatureCounter,
+	}
+	for version := 1; version <= export.Device.KeyVersion; version++ {
+		if publicKey, ok := export.PublicKeys[version]; ok {
+			res.PublicKeys = append(res.PublicKeys, ExportedKeyResponse{KeyVersion: version, PublicKey: string(publicKey)})
+		}
+	}
+
+	return res
+}
+
+// ConvertToDomain converts ChainExportResponse back to domain.ChainExport
+func (e ChainExportResponse) ConvertToDomain() (domain.ChainExport, error) {
+	algorithm, ok := parseAlgorithm(e.Device.Algorithm)
+	if !ok {
+		return domain.ChainExport{}, fmt.Errorf("unknown algorithm %q", e.Device.Algorithm)
+	}
+
+	export := domain.ChainExport{
+		Device: domain.Device{
+			ID:         e.Device.ID,
+			Algorithm:  algorithm,
+			Label:      e.Device.Label,
+			Encoding:   getEncoding(e.Device.SignatureEncoding),
+			Curve:      domain.Curve(e.Device.Curve),
+			KeySize:    e.Device.KeySize,
+			KeyVersion: e.Device.KeyVersion,
+			KeyStorage: domain.KeyStorage(e.Device.KeyStorage),
+			Status:     domain.DeviceStatus(e.Device.Status),
+			CreatedAt:  e.Device.CreatedAt,
+		},
+		PublicKeys:       make(map[int][]byte, len(e.PublicKeys)),
+		SignatureCounter: e.SignatureCounter,
+		Entries:          make([]domain.JournalEntry, 0, len(e.Entries)),
+	}
+	for _, key := range e.PublicKeys {
+		export.PublicKeys[key.KeyVersion] = []byte(key.PublicKey)
+	}
+	// exports without key versions were signed with the first and only key
+	if len(e.PublicKeys) == 0 {
+		export.PublicKeys[1] = []byte(e.PublicKey)
+	}
+	if start := e.Device.ChainStart; start != nil {
+		lastSignature, err := base64.StdEncoding.DecodeString(start.LastSignature)
+		if err != nil {
+			return domain.ChainExport{}, fmt.Errorf("invalid chain start signature: %w", err)
+		}
+		export.Device.ChainStart = &domain.ChainStart{Counter: start.Counter, LastSignature: lastSignature}
+	}
+
+	for _, entry := range e.Entries {
+		hash, err := hex.DecodeString(entry.RawDataSHA256)
+		if err != nil {
+			return domain.ChainExport{}, fmt.Errorf("entry %d: invalid data hash: %w", entry.Counter, err)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(entry.Signature)
+		if err != nil {
+			return domain.ChainExport{}, fmt.Errorf("entry %d: invalid signature: %w", entry.Counter, err)
+		}
+
+		export.Entries = append(export.Entries, domain.JournalEntry{
+			Counter:       entry.Counter,
+			RawData:       entry.RawData,
+			RawDataHash:   hash,
+			SecuredData:   entry.SignedData,
+			Signature:     signature,
+			LastSignature: entry.LastSignature,
+			KeyVersion:    keyVersion(entry.KeyVersion),
+			CreatedAt:     entry.CreatedAt,
+		})
+	}
+
+	return export, nil
+}
+
+// keyVersion returns the key version of an exported entry, entries exported before key rotation have none.
+func keyVersion(version int) int {
+	if version == 0 {
+		return 1
+	}
+
+	return version
+}
@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+func TestServer_ExportChain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, signature := newServer()
+
+	// more signatures than fit on one journal page
+	signatures := domain.MaxPageSize + 2
+	deviceID := createDevice(t, signature)
+	for n := 0; n < signatures; n++ {
+		if _, err := signature.SignTx(ctx, deviceID, fmt.Sprintf("tx-%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		deviceID uuid.UUID
+		entries  int
+	}{
+		{name: "signed device", deviceID: deviceID, entries: signatures},
+		{name: "new device", deviceID: createDevice(t, signature), entries: 0},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+tt.deviceID.String()+"/chain/export", nil)
+		recorder := serve(server, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", tt.name, http.StatusOK, recorder.Code)
+		}
+
+		// the streamed document is read back like the verify-chain command does
+		var document api.ChainExportResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+			t.Fatalf("%s: invalid export: %v", tt.name, err)
+		}
+		export, err := document.ConvertToDomain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if export.Device.ID != tt.deviceID || len(export.Entries) != tt.entries {
+			t.Fatalf("%s: expected %d entries of the device, got %d", tt.name, tt.entries, len(export.Entries))
+		}
+
+		publicKey, err := crypto.ParsePEMPublicKey(export.Device, export.PublicKeys[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := crypto.NewPublicKeyVerifier(publicKey, crypto.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := service.VerifyExport(export, map[int]crypto.Verifier{1: verifier}, nil)
+		if !report.Valid || report.VerifiedSignatures != int64(tt.entries) {
+			t.Fatalf("%s: unexpected report %+v", tt.name, report)
+		}
+	}
+
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+uuid.New().String()+"/chain/export", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for an unknown device, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
@@ -1,65 +1,204 @@
 package api
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
 type Algorithm string
 
 const (
-	RSA Algorithm = "RSA"
-	ECC Algorithm = "ECC"
+	RSA            Algorithm = "RSA"
+	RSAPKCS1SHA256 Algorithm = "RSA_PKCS1_SHA256"
+	RSAPSSSHA256   Algorithm = "RSA_PSS_SHA256"
+	ECC            Algorithm = "ECC"
+	ED25519        Algorithm = "ED25519"
+)
+
+type Encoding string
+
+const (
+	DER   Encoding = "DER"
+	P1363 Encoding = "P1363"
 )
 
 type CreateSignatureDevice struct {
 	ID        uuid.UUID `json:"id" validate:"required"`
-	Algorithm Algorithm `json:"algorithm" validate:"required,oneof='RSA' 'ECC'"`
+	Algorithm Algorithm `json:"algorithm" validate:"required,oneof='RSA' 'RSA_PKCS1_SHA256' 'RSA_PSS_SHA256' 'ECC' 'ED25519'"`
 	Label     *string   `json:"label"`
+	Encoding  Encoding  `json:"signature_encoding" validate:"omitempty,oneof='DER' 'P1363'"`
+	// Curve and KeySize are optional, they are checked against the key policy of the service.
+	Curve   string `json:"curve"`
+	KeySize int    `json:"key_size" validate:"gte=0"`
+	// Activate set to false leaves the device initialized, it has to be activated before it signs.
+	Activate *bool `json:"activate"`
+	// KeyStorage selects where the private key is held, software by default. pkcs11 keeps it on the HSM.
+	KeyStorage string `json:"key_storage" validate:"omitempty,oneof='software' 'pkcs11'"`
+	// PrivateKey imports an existing PEM encoded key instead of generating one: PKCS#8, SEC1, PKCS#1 or
+	// encrypted PKCS#8, which is decrypted with Passphrase.
+	PrivateKey string `json:"private_key"`
+	Passphrase string `json:"passphrase"`
+}
+
+// DeviceResponse is the API representation of a device, it never contains key material.
+type DeviceResponse struct {
+	ID                uuid.UUID `json:"id"`
+	Algorithm         Algorithm `json:"algorithm"`
+	Label             *string   `json:"label"`
+	SignatureEncoding Encoding  `json:"signature_encoding,omitempty"`
+	Curve             string    `json:"curve,omitempty"`
+	KeySize           int       `json:"key_size,omitempty"`
+	KeyVersion        int       `json:"key_version"`
+	KeyStorage        string    `json:"key_storage"`
+	Status            string    `json:"status"`
+	CreatedAt         time.Time `json:"created_at"`
+	// ChainStart is set for devices migrated from another system.
+	ChainStart *ChainStartResponse `json:"chain_start,omitempty"`
+}
+
+// ChainStartResponse is where the signature chain of a migrated device continues,
+// LastSignature is the base64 encoded signature its first signature links to.
+type ChainStartResponse struct {
+	Counter       int64  `json:"counter"`
+	LastSignature string `json:"last_signature"`
+}
+
+// DeviceDetailsResponse is a device together with the state of its signature chain.
+type DeviceDetailsResponse struct {
+	DeviceResponse
+	SignatureCounter int64  `json:"signature_counter"`
+	LastSignature    string `json:"last_signature,omitempty"`
+	KeyFingerprint   string `json:"key_fingerprint"`
+
+	StatusHistory []StatusTransitionResponse `json:"status_history"`
+}
+
+// StatusTransitionResponse is a recorded change of the lifecycle state of a device.
+type StatusTransitionResponse struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+type DeviceListResponse struct {
+	Devices    []DeviceResponse `json:"devices"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// UpdateDeviceRequest changes the label and moves the device through its lifecycle,
+// a status change has to state a reason.
+type UpdateDeviceRequest struct {
+	Label  *string `json:"label"`
+	Status *string `json:"status" validate:"omitempty,oneof='active' 'suspended' 'decommissioned'"`
+	Reason string  `json:"reason" validate:"required_with=Status"`
 }
 
 // CreateSignatureDevice create a device with provided type of signature
 func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *http.Request) {
-	if request.Method != http.MethodPost {
-		WriteMethodNotAllowed(response)
+	res, ok := s.createDevice(response, request)
+	if !ok {
+		return
+	}
 
+	WriteAPIResponse(response, http.StatusOK, struct {
+		ID uuid.UUID `json:"id"`
+	}{
+		ID: res,
+	})
+}
+
+// CreateDevice creates a device in the devices collection and points to it in the Location header
+func (s *Server) CreateDevice(response http.ResponseWriter, request *http.Request) {
+	res, ok := s.createDevice(response, request)
+	if !ok {
 		return
 	}
 
+	response.Header().Set("Location", "/api/v0/devices/"+res.String())
+	WriteAPIResponse(response, http.StatusCreated, struct {
+		ID uuid.UUID `json:"id"`
+	}{
+		ID: res,
+	})
+}
+
+func (s *Server) createDevice(response http.ResponseWriter, request *http.Request) (uuid.UUID, bool) {
 	var device CreateSignatureDevice
 
-	// Try to decode the request body into the struct. If there is an error,
-	// respond to the client with the error message and a 400 status code.
-	err := json.NewDecoder(request.Body).Decode(&device)
+	if !s.decodeRequest(response, request, "CreateSignatureDevice", &device) {
+		return uuid.Nil, false
+	}
 
+	var (
+		res uuid.UUID
+		err error
+	)
+	if device.PrivateKey != "" {
+		res, err = s.signature.ImportDevice(request.Context(), device.ConvertToDomain(), []byte(device.PrivateKey), []byte(device.Passphrase))
+	} else {
+		res, err = s.signature.CreateDevice(request.Context(), device.ConvertToDomain())
+	}
 	if err != nil {
-		log.Println("[WARNING][CreateSignatureDevice] decode error", err)
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Invalid request body was sent",
-		})
-		return
+		if errors.Is(err, domain.ErrEncodingNotAllowed) || errors.Is(err, domain.ErrKeyParamsNotAllowed) ||
+			errors.Is(err, domain.ErrKeyStorageNotAvailable) || errors.Is(err, domain.ErrKeyStorageAlgorithm) ||
+			errors.Is(err, domain.ErrKeyAlgorithmMismatch) || isInvalidImport(err) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
+			})
+
+			return uuid.Nil, false
+		}
+		if errors.Is(err, domain.ErrDeviceAlreadyExist) {
+			WriteErrorResponse(response, http.StatusConflict, []string{
+				domain.ErrDeviceAlreadyExist.Error(),
+			})
+
+			return uuid.Nil, false
+		}
+		WriteInternalError(response)
+
+		return uuid.Nil, false
 	}
 
-	err = s.v.Struct(&device)
+	return res, true
+}
+
+// isInvalidImport reports whether the private key of an import can't be read.
+func isInvalidImport(err error) bool {
+	return errors.Is(err, crypto.ErrInvalidPrivateKey) || errors.Is(err, crypto.ErrInvalidPEM) ||
+		errors.Is(err, crypto.ErrPassphraseRequired)
+}
+
+// ListDevices returns a page of devices. The query parameters algorithm, status, label_prefix and
+// created_after (RFC 3339) filter the devices, sort orders them (created_at, -created_at, label, -label),
+// limit sets the page size and cursor continues the listing with the next_cursor of the previous page.
+func (s *Server) ListDevices(response http.ResponseWriter, request *http.Request) {
+	query, err := parseDeviceQuery(request)
 	if err != nil {
-		log.Println("[WARNING][CreateSignatureDevice] decode error", err)
+		log.Println("[WARNING][ListDevices] query error", err)
 		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Invalid request body was sent",
+			err.Error(),
 		})
 		return
 	}
 
-	res, err := s.signature.CreateDevice(request.Context(), device.ConvertToDomain())
+	page, err := s.signature.ListDevices(request.Context(), query)
 	if err != nil {
-		if errors.Is(err, domain.ErrDeviceAlreadyExist) {
-			WriteErrorResponse(response, http.StatusConflict, []string{
-				domain.ErrDeviceAlreadyExist.Error(),
+		log.Println("[WARN][ListDevices] error", err)
+		if errors.Is(err, domain.ErrInvalidCursor) || errors.Is(err, domain.ErrInvalidSort) {
+			WriteErrorResponse(response, http.StatusBadRequest, []string{
+				err.Error(),
 			})
 
 			return
@@ -69,29 +208,269 @@ func (s *Server) CreateSignatureDevice(response http.ResponseWriter, request *ht
 		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, struct {
-		ID uuid.UUID `json:"id"`
-	}{
-		ID: res,
-	})
+	res := DeviceListResponse{
+		Devices:    make([]DeviceResponse, 0, len(page.Devices)),
+		NextCursor: page.NextCursor,
+	}
+	for _, device := range page.Devices {
+		res.Devices = append(res.Devices, ToDeviceResponse(device))
+	}
+
+	WriteAPIResponse(response, http.StatusOK, res)
+}
+
+// GetDevice returns a single device with its signature counter, last signature and key fingerprint
+func (s *Server) GetDevice(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	device, err := s.signature.GetDevice(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "GetDevice", err)
+
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, ToDeviceDetailsResponse(device))
+}
+
+// UpdateDevice changes the label of a device and its lifecycle status
+func (s *Server) UpdateDevice(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	var update UpdateDeviceRequest
+	if !s.decodeRequest(response, request, "UpdateDevice", &update) {
+		return
+	}
+
+	change := domain.DeviceUpdate{
+		Label:  update.Label,
+		Reason: update.Reason,
+	}
+	if update.Status != nil {
+		status := domain.DeviceStatus(*update.Status)
+		change.Status = &status
+	}
+
+	device, err := s.signature.UpdateDevice(request.Context(), deviceID, change)
+	if err != nil {
+		writeDeviceError(response, "UpdateDevice", err)
+
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, ToDeviceResponse(device))
+}
+
+// ToDeviceResponse converts domain.Device to DeviceResponse
+func ToDeviceResponse(device domain.Device) DeviceResponse {
+	res := DeviceResponse{
+		ID:         device.ID,
+		Algorithm:  algorithmName(device.Algorithm),
+		Label:      device.Label,
+		Curve:      string(device.Curve),
+		KeySize:    device.KeySize,
+		KeyVersion: device.KeyVersion,
+		KeyStorage: string(device.KeyStorage),
+		Status:     string(device.Status),
+		CreatedAt:  device.CreatedAt,
+	}
+	// only ECDSA signatures have more than one encoding
+	if device.Algorithm == domain.ECDSA {
+		res.SignatureEncoding = encodingName(device.Encoding)
+	}
+	if start := device.ChainStart; start != nil {
+		res.ChainStart = &ChainStartResponse{
+			Counter:       start.Counter,
+			LastSignature: base64.StdEncoding.EncodeToString(start.LastSignature),
+		}
+	}
+
+	return res
+}
+
+// parseDeviceQuery reads the filters, the order and the page of a device listing from the query string.
+func parseDeviceQuery(request *http.Request) (domain.DeviceQuery, error) {
+	params := request.URL.Query()
+
+	query := domain.DeviceQuery{
+		Status:      domain.DeviceStatus(params.Get("status")),
+		LabelPrefix: params.Get("label_prefix"),
+		Sort:        domain.DeviceSort(params.Get("sort")),
+		Cursor:      params.Get("cursor"),
+	}
+
+	if value := params.Get("algorithm"); value != "" {
+		algorithm, ok := parseAlgorithm(Algorithm(value))
+		if !ok {
+			return domain.DeviceQuery{}, fmt.Errorf("unknown algorithm %q", value)
+		}
+		query.Algorithm = &algorithm
+	}
+
+	if query.Status != "" && !query.Status.Valid() {
+		return domain.DeviceQuery{}, fmt.Errorf("unknown status %q", query.Status)
+	}
+
+	if value := params.Get("created_after"); value != "" {
+		createdAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return domain.DeviceQuery{}, errors.New("created_after isn't a RFC 3339 timestamp")
+		}
+		query.CreatedAfter = createdAfter
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return domain.DeviceQuery{}, errors.New("limit must be a positive number")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// ToDeviceDetailsResponse converts domain.DeviceDetails to DeviceDetailsResponse
+func ToDeviceDetailsResponse(details domain.DeviceDetails) DeviceDetailsResponse {
+	res := DeviceDetailsResponse{
+		DeviceResponse:   ToDeviceResponse(details.Device),
+		SignatureCounter: details.SignatureCounter,
+		KeyFingerprint:   details.KeyFingerprint,
+		StatusHistory:    make([]StatusTransitionResponse, 0, len(details.StatusHistory)),
+	}
+	for _, transition := range details.StatusHistory {
+		res.StatusHistory = append(res.StatusHistory, StatusTransitionResponse{
+			From:   string(transition.From),
+			To:     string(transition.To),
+			Reason: transition.Reason,
+			At:     transition.At,
+		})
+	}
+	if len(details.LastSignature) > 0 {
+		res.LastSignature = base64.StdEncoding.EncodeToString(details.LastSignature)
+	}
+
+	return res
+}
+
+// deviceIDParam parses the {id} path parameter, a malformed ID is answered with 404.
+func deviceIDParam(response http.ResponseWriter, request *http.Request) (uuid.UUID, bool) {
+	deviceID, err := uuid.Parse(PathParam(request, "id"))
+	if err != nil {
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			domain.ErrNotFound.Error(),
+		})
+
+		return uuid.Nil, false
+	}
+
+	return deviceID, true
+}
+
+// writeDeviceError answers errors of device operations, unknown devices with 404
+// and status changes the lifecycle doesn't allow with 409.
+func writeDeviceError(response http.ResponseWriter, handler string, err error) {
+	log.Printf("[WARN][%s] error %v", handler, err)
+	if errors.Is(err, domain.ErrDeviceNotFound) {
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			domain.ErrNotFound.Error(),
+		})
+
+		return
+	}
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		WriteErrorCodeResponse(response, http.StatusConflict, CodeInvalidTransition, []string{
+			domain.ErrInvalidTransition.Error(),
+		})
+
+		return
+	}
+	if errors.Is(err, domain.ErrReasonRequired) {
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			domain.ErrReasonRequired.Error(),
+		})
+
+		return
+	}
+
+	WriteInternalError(response)
 }
 
 // ConvertToDomain converts CreateSignatureDevice to domain.Device
 func (d CreateSignatureDevice) ConvertToDomain() domain.Device {
-	return domain.Device{
-		ID:        d.ID,
-		Algorithm: getAlgorithm(d.Algorithm),
-		Label:     d.Label,
+	device := domain.Device{
+		ID:         d.ID,
+		Algorithm:  getAlgorithm(d.Algorithm),
+		Label:      d.Label,
+		Encoding:   getEncoding(d.Encoding),
+		Curve:      domain.Curve(d.Curve),
+		KeySize:    d.KeySize,
+		KeyStorage: domain.KeyStorage(d.KeyStorage),
+	}
+	if d.Activate != nil && !*d.Activate {
+		device.Status = domain.StatusInitialized
+	}
+
+	return device
+}
+
+func parseAlgorithm(algorithm Algorithm) (domain.Algorithm, bool) {
+	switch algorithm {
+	case RSA, RSAPKCS1SHA256, RSAPSSSHA256, ECC, ED25519:
+		return getAlgorithm(algorithm), true
+	default:
+		return 0, false
 	}
 }
 
 func getAlgorithm(algorithm Algorithm) domain.Algorithm {
 	switch algorithm {
-	case RSA:
-		return domain.RSA
+	case RSA, RSAPKCS1SHA256:
+		return domain.RSAPKCS1SHA256
+	case RSAPSSSHA256:
+		return domain.RSAPSSSHA256
 	case ECC:
 		return domain.ECDSA
+	case ED25519:
+		return domain.Ed25519
 	default:
 		return domain.ECDSA
 	}
 }
+
+func algorithmName(algorithm domain.Algorithm) Algorithm {
+	switch algorithm {
+	case domain.RSAPKCS1SHA256:
+		return RSAPKCS1SHA256
+	case domain.RSAPSSSHA256:
+		return RSAPSSSHA256
+	case domain.ECDSA:
+		return ECC
+	case domain.Ed25519:
+		return ED25519
+	default:
+		return ""
+	}
+}
+
+func encodingName(encoding domain.SignatureEncoding) Encoding {
+	if encoding == domain.EncodingP1363 {
+		return P1363
+	}
+
+	return DER
+}
+
+func getEncoding(encoding Encoding) domain.SignatureEncoding {
+	if encoding == P1363 {
+		return domain.EncodingP1363
+	}
+
+	return domain.EncodingDER
+}
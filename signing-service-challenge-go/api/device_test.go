@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+)
+
+func TestServer_GetDevice(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, signature := newServer()
+	deviceID := createDevice(t, signature)
+
+	var lastSignature string
+	for _, data := range []string{"first", "second"} {
+		signed, err := signature.SignTx(ctx, deviceID, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lastSignature = signed.Signature
+	}
+	publicKey, err := signature.PublicKey(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := publicKey.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+deviceID.String(), nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	// no private key material in any form
+	body := recorder.Body.String()
+	if strings.Contains(body, "private_key") || strings.Contains(body, "PRIVATE") {
+		t.Fatalf("the response exposes the private key: %s", body)
+	}
+
+	var response struct {
+		Data api.DeviceDetailsResponse `json:"data"`
+	}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	details := response.Data
+	if details.ID != deviceID || details.SignatureCounter != 2 || details.LastSignature != lastSignature ||
+		details.KeyFingerprint != fingerprint || details.Status != "active" || len(details.StatusHistory) != 1 {
+		t.Fatalf("unexpected device details %+v", details)
+	}
+
+	recorder = serve(server, httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+uuid.New().String(), nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for an unknown device, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// JournalEntryResponse is a signature of the journal of a device.
+type JournalEntryResponse struct {
+	Counter int64 `json:"counter"`
+	// RawData is omitted when the service only keeps the hash of the data, SignedData is redacted then.
+	RawData       string    `json:"raw_data,omitempty"`
+	RawDataSHA256 string    `json:"raw_data_sha256"`
+	SignedData    string    `json:"signed_data"`
+	Signature     string    `json:"signature"`
+	LastSignature string    `json:"last_signature"`
+	KeyVersion    int       `json:"key_version"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type JournalResponse struct {
+	Entries []JournalEntryResponse `json:"entries"`
+	// NextFrom is the from parameter of the next page, it is omitted on the last page.
+	NextFrom *int64 `json:"next_from,omitempty"`
+}
+
+// ListSignatures returns a page of the signature journal of a device. The query parameters from and to
+// select an inclusive counter range, limit sets the page size and next_from continues with the next page.
+func (s *Server) ListSignatures(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	query, err := parseJournalQuery(request)
+	if err != nil {
+		log.Println("[WARNING][ListSignatures] query error", err)
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			err.Error(),
+		})
+		return
+	}
+
+	page, err := s.signature.ListSignatures(request.Context(), deviceID, query)
+	if err != nil {
+		writeDeviceError(response, "ListSignatures", err)
+
+		return
+	}
+
+	res := JournalResponse{
+		Entries:  make([]JournalEntryResponse, 0, len(page.Entries)),
+		NextFrom: page.NextFrom,
+	}
+	for _, entry := range page.Entries {
+		res.Entries = append(res.Entries, ToJournalEntryResponse(entry))
+	}
+
+	WriteAPIResponse(response, http.StatusOK, res)
+}
+
+// GetSignature returns the journal entry of a device with the counter of the path
+func (s *Server) GetSignature(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	counter, err := strconv.ParseInt(PathParam(request, "counter"), 10, 64)
+	if err != nil || counter < 0 {
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			domain.ErrNotFound.Error(),
+		})
+
+		return
+	}
+
+	entry, err := s.signature.GetSignature(request.Context(), deviceID, counter)
+	if err != nil {
+		if errors.Is(err, domain.ErrSignatureNotFound) {
+			WriteErrorResponse(response, http.StatusNotFound, []string{
+				domain.ErrSignatureNotFound.Error(),
+			})
+
+			return
+		}
+		writeDeviceError(response, "GetSignature", err)
+
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, ToJournalEntryResponse(entry))
+}
+
+// ToJournalEntryResponse converts domain.JournalEntry to JournalEntryResponse
+func ToJournalEntryResponse(entry domain.JournalEntry) JournalEntryResponse {
+	return JournalEntryResponse{
+		Counter:       entry.Counter,
+		RawData:       entry.RawData,
+		RawDataSHA256: hex.EncodeToString(entry.RawDataHash),
+		SignedData:    entry.SecuredData,
+		Signature:     base64.StdEncoding.EncodeToString(entry.Signature),
+		LastSignature: entry.LastSignature,
+		KeyVersion:    entry.KeyVersion,
+		CreatedAt:     entry.CreatedAt,
+	}
+}
+
+// parseJournalQuery reads the counter range and the page size of a journal listing from the query string.
+func parseJournalQuery(request *http.Request) (domain.JournalQuery, error) {
+	params := request.URL.Query()
+
+	var query domain.JournalQuery
+
+	if value := params.Get("from"); value != "" {
+		from, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || from < 0 {
+			return domain.JournalQuery{}, errors.New("from must be a counter")
+		}
+		query.From = from
+	}
+
+	if value := params.Get("to"); value != "" {
+		to, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || to < query.From {
+			return domain.JournalQuery{}, errors.New("to must be a counter not before from")
+		}
+		query.To = &to
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return domain.JournalQuery{}, errors.New("limit must be a positive number")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// JWKSPath is the well-known location of the JSON Web Key Set.
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWKS writes the public keys of all active devices as JSON Web Key Set.
+// ECDSA devices with DER encoded signatures are listed without alg, JOSE libraries can't verify their signatures.
+// The response carries an ETag, a matching If-None-Match header is answered with 304 Not Modified.
+func (s *Server) JWKS(response http.ResponseWriter, request *http.Request) {
+	set, err := s.signature.JWKS(request.Context())
+	if err != nil {
+		log.Println("[WARN][JWKS] error", err)
+		WriteInternalError(response)
+
+		return
+	}
+
+	body, err := json.Marshal(set)
+	if err != nil {
+		log.Println("[WARN][JWKS] encode error", err)
+		WriteInternalError(response)
+
+		return
+	}
+
+	digest := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(digest[:]) + `"`
+
+	response.Header().Set("ETag", etag)
+	// caches may keep the set, but have to revalidate it, so removed keys disappear right away
+	response.Header().Set("Cache-Control", "no-cache")
+
+	if matchesETag(request.Header.Get("If-None-Match"), etag) {
+		response.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if request.Method == http.MethodGet {
+		response.Write(body) //nolint:errcheck
+	}
+}
+
+// matchesETag reports whether the If-None-Match header matches the etag, weak validators included.
+func matchesETag(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,144 @@
+package api_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestServer_JWKS(t *testing.T) {
+	t.Parallel()
+
+	server, signature := newServer()
+	deviceID := createDevice(t, signature)
+
+	fetch := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, api.JWKSPath, nil)
+		if ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		return serve(server, request)
+	}
+
+	first := fetch("")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("expected a revalidated ETag, got headers %v", first.Header())
+	}
+	var set crypto.JWKSet
+	if err := json.Unmarshal(first.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kid != domain.KeyID(deviceID, 1) {
+		t.Fatalf("unexpected key set %+v", set)
+	}
+
+	// an unchanged set isn't sent again, weak validators and lists of tags match as well
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		refetch := fetch(ifNoneMatch)
+		if refetch.Code != http.StatusNotModified || refetch.Body.Len() != 0 {
+			t.Fatalf("If-None-Match %s: expected status %d without body, got %d", ifNoneMatch, http.StatusNotModified, refetch.Code)
+		}
+		if refetch.Header().Get("ETag") != etag {
+			t.Fatalf("If-None-Match %s: expected ETag %s, got %s", ifNoneMatch, etag, refetch.Header().Get("ETag"))
+		}
+	}
+
+	// a new device changes the set and its ETag
+	createDevice(t, signature)
+
+	changed := fetch(etag)
+	if changed.Code != http.StatusOK {
+		t.Fatalf("expected status %d after a device change, got %d", http.StatusOK, changed.Code)
+	}
+	if changedETag := changed.Header().Get("ETag"); changedETag == "" || changedETag == etag {
+		t.Fatalf("expected a new ETag, got %q", changedETag)
+	}
+	if err := json.Unmarshal(changed.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(set.Keys))
+	}
+}
+
+func TestServer_JWKS_VerifiesSignature(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server, signature := newServer()
+	derID := createDevice(t, signature)
+	p1363ID, err := signature.CreateDevice(ctx, domain.Device{
+		ID:        uuid.New(),
+		Algorithm: domain.ECDSA,
+		Curve:     domain.CurveP256,
+		Encoding:  domain.EncodingP1363,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signature.SignTx(ctx, p1363ID, "receipt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := serve(server, httptest.NewRequest(http.MethodGet, api.JWKSPath, nil))
+	var set crypto.JWKSet
+	if err = json.Unmarshal(recorder.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]crypto.JWK, len(set.Keys))
+	for _, jwk := range set.Keys {
+		keys[jwk.Kid] = jwk
+	}
+
+	// JOSE verifiers can't parse DER signatures, so the key doesn't claim ES256
+	if jwk, ok := keys[domain.KeyID(derID, 1)]; !ok || jwk.Alg != "" {
+		t.Fatalf("expected the key of the DER device without alg, got %+v", jwk)
+	}
+
+	// verify the signature like a JWS ES256 verifier would, with nothing but the published JWK
+	jwk, ok := keys[domain.KeyID(p1363ID, 1)]
+	if !ok || jwk.Kty != "EC" || jwk.Crv != "P-256" || jwk.Alg != "ES256" {
+		t.Fatalf("unexpected JWK of the P1363 device %+v", jwk)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+	raw, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 64 {
+		t.Fatalf("expected a 64 byte r||s signature, got %d bytes", len(raw))
+	}
+	digest := sha256.Sum256([]byte(signed.SignedData))
+	r, s := new(big.Int).SetBytes(raw[:32]), new(big.Int).SetBytes(raw[32:])
+	if !ecdsa.Verify(publicKey, digest[:], r, s) {
+		t.Fatal("the signature doesn't verify with the published JWK")
+	}
+}
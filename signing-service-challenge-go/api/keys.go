@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// DeviceKeyResponse is a version of the key pair of a device. Retired versions don't sign anymore.
+type DeviceKeyResponse struct {
+	KeyVersion int `json:"key_version"`
+	// Kid is the key ID of the version in the JSON Web Key Set.
+	Kid string `json:"kid"`
+	// PublicKey is the PEM encoded PKIX public key of the version.
+	PublicKey string     `json:"public_key"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// RotateKey replaces the key pair of a device by a new version, the signature chain continues with the new key.
+// It is served behind the admin guard, the authenticated admin is recorded in the audit trail.
+func (s *Server) RotateKey(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	device, err := s.signature.RotateKey(request.Context(), deviceID, adminActor(request))
+	if err != nil {
+		if errors.Is(err, domain.ErrKeyRotationNotAllowed) || errors.Is(err, domain.ErrKeyVersionChanged) {
+			log.Println("[WARN][RotateKey] error", err)
+			WriteErrorResponse(response, http.StatusConflict, []string{
+				err.Error(),
+			})
+
+			return
+		}
+		writeDeviceError(response, "RotateKey", err)
+
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, ToDeviceResponse(device))
+}
+
+// ListKeys returns all key versions of a device, oldest first
+func (s *Server) ListKeys(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	details, err := s.signature.GetDevice(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "ListKeys", err)
+
+		return
+	}
+
+	keys, err := s.signature.DeviceKeys(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "ListKeys", err)
+
+		return
+	}
+
+	res := make([]DeviceKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		publicKey, errParse := crypto.ParsePublicKey(details.Device, key.PublicKey)
+		if errParse != nil {
+			log.Println("[WARN][ListKeys] public key error", errParse)
+			WriteInternalError(response)
+
+			return
+		}
+
+		publicKeyPEM, errPEM := publicKey.PEM()
+		if errPEM != nil {
+			log.Println("[WARN][ListKeys] encode error", errPEM)
+			WriteInternalError(response)
+
+			return
+		}
+
+		res = append(res, DeviceKeyResponse{
+			KeyVersion: key.Version,
+			Kid:        domain.KeyID(deviceID, key.Version),
+			PublicKey:  string(publicKeyPEM),
+			CreatedAt:  key.CreatedAt,
+			RetiredAt:  key.RetiredAt,
+		})
+	}
+
+	WriteAPIResponse(response, http.StatusOK, res)
+}
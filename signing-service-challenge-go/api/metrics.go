@@ -0,0 +1,19 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+// Metrics writes the metrics of all registered collectors in the Prometheus text exposition format.
+func (s *Server) Metrics(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	response.WriteHeader(http.StatusOK)
+
+	for _, collector := range s.metrics {
+		if err := collector.WriteMetrics(response); err != nil {
+			log.Println("[WARN][Metrics] write error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+const (
+	MediaTypePEM  = "application/x-pem-file"
+	MediaTypeDER  = "application/x-der"
+	MediaTypeJWK  = "application/jwk+json"
+	MediaTypeJSON = "application/json"
+
+	// FingerprintHeader carries the hex encoded SHA-256 digest of the DER encoded public key.
+	FingerprintHeader = "X-Key-Fingerprint-SHA256"
+)
+
+// publicKeyFormats maps the accepted media types to the media type of the response.
+var publicKeyFormats = map[string]string{
+	MediaTypePEM:               MediaTypePEM,
+	MediaTypeDER:               MediaTypeDER,
+	"application/octet-stream": MediaTypeDER,
+	MediaTypeJWK:               MediaTypeJWK,
+	MediaTypeJSON:              MediaTypeJWK,
+	"*/*":                      MediaTypePEM,
+	"application/*":            MediaTypePEM,
+}
+
+// GetPublicKey writes the public key of a device as PEM, DER or JWK, depending on the Accept header.
+// The format query parameter (pem, der, jwk) takes precedence over the Accept header.
+func (s *Server) GetPublicKey(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
+		return
+	}
+
+	mediaType, ok := negotiatePublicKey(request)
+	if !ok {
+		WriteErrorResponse(response, http.StatusNotAcceptable, []string{
+			"Supported formats are " + strings.Join([]string{MediaTypePEM, MediaTypeDER, MediaTypeJWK}, ", "),
+		})
+		return
+	}
+
+	publicKey, err := s.signature.PublicKey(request.Context(), deviceID)
+	if err != nil {
+		writeDeviceError(response, "GetPublicKey", err)
+
+		return
+	}
+
+	body, err := encodePublicKey(publicKey, mediaType)
+	if err != nil {
+		log.Println("[WARN][GetPublicKey] encode error", err)
+		WriteInternalError(response)
+
+		return
+	}
+
+	fingerprint, err := publicKey.Fingerprint()
+	if err != nil {
+		log.Println("[WARN][GetPublicKey] fingerprint error", err)
+		WriteInternalError(response)
+
+		return
+	}
+
+	response.Header().Set("Content-Type", mediaType)
+	response.Header().Set("Vary", "Accept")
+	response.Header().Set(FingerprintHeader, fingerprint)
+	response.WriteHeader(http.StatusOK)
+	response.Write(body) //nolint:errcheck
+}
+
+func encodePublicKey(publicKey crypto.PublicKey, mediaType string) ([]byte, error) {
+	switch mediaType {
+	case MediaTypeDER:
+		return publicKey.DER()
+	case MediaTypeJWK:
+		jwk, err := publicKey.JWK()
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(jwk)
+	default:
+		return publicKey.PEM()
+	}
+}
+
+// negotiatePublicKey picks the response media type from the format parameter or the Accept header.
+func negotiatePublicKey(request *http.Request) (string, bool) {
+	switch request.URL.Query().Get("format") {
+	case "pem":
+		return MediaTypePEM, true
+	case "der":
+		return MediaTypeDER, true
+	case "jwk":
+		return MediaTypeJWK, true
+	}
+
+	accept := request.Header.Get("Accept")
+	if accept == "" {
+		return MediaTypePEM, true
+	}
+
+	for _, mediaType := range acceptedMediaTypes(accept) {
+		if format, ok := publicKeyFormats[mediaType]; ok {
+			return format, true
+		}
+	}
+
+	return "", false
+}
+
+// acceptedMediaTypes returns the media types of an Accept header ordered by their quality.
+func acceptedMediaTypes(accept string) []string {
+	type accepted struct {
+		mediaType string
+		quality   float64
+	}
+
+	var types []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			types = append(types, accepted{mediaType: mediaType, quality: quality})
+		}
+	}
+
+	sort.SliceStable(types, func(i, j int) bool { return types[i].quality > types[j].quality })
+
+	mediaTypes := make([]string, 0, len(types))
+	for _, t := range types {
+		mediaTypes = append(mediaTypes, t.mediaType)
+	}
+
+	return mediaTypes
+}
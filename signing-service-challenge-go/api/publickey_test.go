@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+func TestServer_GetPublicKey(t *testing.T) {
+	t.Parallel()
+
+	server, signature := newServer()
+	deviceID := createDevice(t, signature)
+
+	publicKey, err := signature.PublicKey(context.Background(), deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := publicKey.DER()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := publicKey.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/api/v0/devices/" + deviceID.String() + "/public-key"
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		contentType string
+	}{
+		{name: "default", contentType: api.MediaTypePEM},
+		{name: "any", accept: "*/*", contentType: api.MediaTypePEM},
+		{name: "PEM", accept: api.MediaTypePEM, contentType: api.MediaTypePEM},
+		{name: "DER", accept: api.MediaTypeDER, contentType: api.MediaTypeDER},
+		{name: "octet stream", accept: "application/octet-stream", contentType: api.MediaTypeDER},
+		{name: "JWK", accept: api.MediaTypeJWK, contentType: api.MediaTypeJWK},
+		{name: "JSON", accept: "application/json", contentType: api.MediaTypeJWK},
+		{name: "quality", accept: "application/x-pem-file;q=0.5, application/x-der", contentType: api.MediaTypeDER},
+		{name: "format over Accept", query: "?format=jwk", accept: api.MediaTypeDER, contentType: api.MediaTypeJWK},
+		{name: "format DER", query: "?format=der", contentType: api.MediaTypeDER},
+		{name: "unsupported", accept: "text/html"},
+		{name: "unsupported format", query: "?format=xml", accept: "text/html"},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, path+tt.query, nil)
+		if tt.accept != "" {
+			request.Header.Set("Accept", tt.accept)
+		}
+		response := serve(server, request)
+
+		if tt.contentType == "" {
+			if response.Code != http.StatusNotAcceptable {
+				t.Fatalf("%s: expected status %d, got %d", tt.name, http.StatusNotAcceptable, response.Code)
+			}
+			continue
+		}
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", tt.name, http.StatusOK, response.Code)
+		}
+		if contentType := response.Header().Get("Content-Type"); contentType != tt.contentType {
+			t.Fatalf("%s: expected Content-Type %q, got %q", tt.name, tt.contentType, contentType)
+		}
+		if got := response.Header().Get(api.FingerprintHeader); got != fingerprint {
+			t.Fatalf("%s: expected fingerprint %q, got %q", tt.name, fingerprint, got)
+		}
+
+		// every format carries the same key
+		switch tt.contentType {
+		case api.MediaTypePEM:
+			block, _ := pem.Decode(response.Body.Bytes())
+			if block == nil || block.Type != "PUBLIC KEY" || !bytes.Equal(block.Bytes, der) {
+				t.Fatalf("%s: unexpected PEM body %q", tt.name, response.Body.String())
+			}
+		case api.MediaTypeDER:
+			if !bytes.Equal(response.Body.Bytes(), der) {
+				t.Fatalf("%s: unexpected DER body", tt.name)
+			}
+		case api.MediaTypeJWK:
+			var jwk crypto.JWK
+			if err = json.Unmarshal(response.Body.Bytes(), &jwk); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if jwk.Kty != "EC" {
+				t.Fatalf("%s: unexpected JWK %+v", tt.name, jwk)
+			}
+		}
+	}
+
+	response := serve(server, httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+uuid.New().String()+"/public-key", nil))
+	if response.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for an unknown device, got %d", http.StatusNotFound, response.Code)
+	}
+}
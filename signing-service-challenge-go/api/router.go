@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type pathParamsKey struct{}
+
+// Router dispatches requests by method and path pattern. Patterns consist of literal segments
+// and {name} parameters, e.g. /api/v0/devices/{id}/signatures.
+// A path without a pattern gets a 404, a known path with an unregistered method a 405 with an Allow header.
+type Router struct {
+	routes []*route
+}
+
+type route struct {
+	segments []string
+	handlers map[string]http.Handler
+}
+
+// NewRouter creates an empty Router.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers the handler for the method and the path pattern.
+func (r *Router) Handle(method, pattern string, handler http.HandlerFunc) {
+	segments := splitPath(pattern)
+
+	for _, rt := range r.routes {
+		if equalSegments(rt.segments, segments) {
+			rt.handlers[method] = handler
+			return
+		}
+	}
+
+	r.routes = append(r.routes, &route{
+		segments: segments,
+		handlers: map[string]http.Handler{method: handler},
+	})
+}
+
+// ServeHTTP dispatches the request to the handler of the best matching route.
+// Literal segments take precedence over parameters.
+func (r *Router) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	path := splitPath(request.URL.Path)
+
+	var (
+		best       *route
+		bestParams map[string]string
+		bestScore  = -1
+	)
+	for _, rt := range r.routes {
+		params, score, ok := rt.match(path)
+		if ok && score > bestScore {
+			best, bestParams, bestScore = rt, params, score
+		}
+	}
+
+	if best == nil {
+		WriteErrorResponse(response, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+		return
+	}
+
+	handler, ok := best.handlers[request.Method]
+	if !ok {
+		response.Header().Set("Allow", strings.Join(best.methods(), ", "))
+		WriteMethodNotAllowed(response)
+		return
+	}
+
+	if len(bestParams) > 0 {
+		request = request.WithContext(context.WithValue(request.Context(), pathParamsKey{}, bestParams))
+	}
+
+	handler.ServeHTTP(response, request)
+}
+
+// PathParam returns the value of the {name} segment of the matched pattern.
+func PathParam(request *http.Request, name string) string {
+	params, _ := request.Context().Value(pathParamsKey{}).(map[string]string)
+
+	return params[name]
+}
+
+// match returns the path parameters and the number of literal segments if the route matches the path.
+func (rt *route) match(path []string) (params map[string]string, score int, ok bool) {
+	if len(path) != len(rt.segments) {
+		return nil, 0, false
+	}
+
+	for i, segment := range rt.segments {
+		if name, isParam := paramName(segment); isParam {
+			if path[i] == "" {
+				return nil, 0, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = path[i]
+
+			continue
+		}
+
+		if segment != path[i] {
+			return nil, 0, false
+		}
+		score++
+	}
+
+	return params, score, true
+}
+
+func (rt *route) methods() []string {
+	methods := make([]string, 0, len(rt.handlers))
+	for method := range rt.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return methods
+}
+
+func paramName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func equalSegments(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+)
+
+func TestRouter_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	router := api.NewRouter()
+	router.Handle(http.MethodGet, "/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("get " + api.PathParam(r, "id"))) //nolint:errcheck
+	})
+	router.Handle(http.MethodPatch, "/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("patch " + api.PathParam(r, "id"))) //nolint:errcheck
+	})
+	router.Handle(http.MethodGet, "/devices/export", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("export")) //nolint:errcheck
+	})
+
+	tests := []struct {
+		method, path string
+		code         int
+		body, allow  string
+	}{
+		{method: http.MethodGet, path: "/devices/42", code: http.StatusOK, body: "get 42"},
+		{method: http.MethodPatch, path: "/devices/42/", code: http.StatusOK, body: "patch 42"},
+		{method: http.MethodGet, path: "/devices/export", code: http.StatusOK, body: "export"},
+		{method: http.MethodDelete, path: "/devices/42", code: http.StatusMethodNotAllowed, allow: "GET, PATCH"},
+		{method: http.MethodGet, path: "/devices/42/keys", code: http.StatusNotFound},
+		{method: http.MethodGet, path: "/devices", code: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if recorder.Code != tt.code {
+			t.Fatalf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.code, recorder.Code)
+		}
+		if tt.body != "" && recorder.Body.String() != tt.body {
+			t.Fatalf("%s %s: expected body %q, got %q", tt.method, tt.path, tt.body, recorder.Body.String())
+		}
+		if allow := recorder.Header().Get("Allow"); allow != tt.allow {
+			t.Fatalf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, allow)
+		}
+	}
+}
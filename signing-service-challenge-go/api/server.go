@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"io"
+	"log"
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
@@ -15,37 +17,102 @@ type Response struct {
 }
 
 // ErrorResponse is the generic error API response container.
+// Code identifies errors clients are expected to handle, it is empty for generic errors.
 type ErrorResponse struct {
+	Code   string   `json:"code,omitempty"`
 	Errors []string `json:"errors"`
 }
 
+// Error codes of ErrorResponse.
+const (
+	CodeDeviceNotActive   = "DEVICE_NOT_ACTIVE"
+	CodeInvalidTransition = "INVALID_STATUS_TRANSITION"
+)
+
+// MetricsCollector writes metrics in the Prometheus text exposition format.
+type MetricsCollector interface {
+	WriteMetrics(w io.Writer) error
+}
+
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
 	listenAddress string
 
 	signature service.Signature
+	metrics   []MetricsCollector
+	// adminTokens are the bearer tokens of the admin routes keyed by the name of their admin,
+	// the routes are disabled without tokens.
+	adminTokens map[string]string
 
 	v *validator.Validate
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, signature service.Signature) *Server {
+func NewServer(listenAddress string, signature service.Signature, metrics ...MetricsCollector) *Server {
 	return &Server{
 		listenAddress: listenAddress,
 		v:             validator.New(),
 		signature:     signature,
+		metrics:       metrics,
 	}
 }
 
 // Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
 func (s *Server) Run() error {
-	mux := http.NewServeMux()
+	return http.ListenAndServe(s.listenAddress, s.Routes())
+}
 
-	mux.Handle("/api/v0/health", http.HandlerFunc(s.Health))
-	mux.Handle("/api/v0/device", http.HandlerFunc(s.CreateSignatureDevice))
-	mux.Handle("/api/v0/sign", http.HandlerFunc(s.SignTransaction))
+// Routes returns the router with all HTTP routes of the Server.
+func (s *Server) Routes() *Router {
+	router := NewRouter()
+
+	router.Handle(http.MethodGet, "/api/v0/health", s.Health)
+
+	router.Handle(http.MethodPost, "/api/v0/devices", s.CreateDevice)
+	router.Handle(http.MethodGet, "/api/v0/devices", s.ListDevices)
+	router.Handle(http.MethodGet, "/api/v0/devices/{id}", s.GetDevice)
+	router.Handle(http.MethodPatch, "/api/v0/devices/{id}", s.UpdateDevice)
+	router.Handle(http.MethodPost, "/api/v0/devices/{id}/signatures", s.CreateSignature)
+	router.Handle(http.MethodGet, "/api/v0/devices/{id}/signatures", s.ListSignatures)
+	router.Handle(http.MethodGet, "/api/v0/devices/{id}/signatures/{counter}", s.GetSignature)
+	router.Handle(http.MethodPost, "/api/v0/devices/{id}/chain/verify", s.VerifyChain)
+	router.Handle(http.MethodGet, "/api/v0/devices/{id}/chain/export", s.ExportChain)
+	router.Handle(http.MethodGet, "/api/v0/devices/{id}/public-key", s.GetPublicKey)
+	router.Handle(http.MethodGet, "/api/v0/devices/{id}/keys", s.ListKeys)
+	router.Handle(http.MethodPost, "/api/v0/devices/{id}/keys:rotate", s.admin(s.RotateKey))
+	router.Handle(http.MethodPost, "/api/v0/verify", s.VerifySignature)
+
+	router.Handle(http.MethodPost, "/api/v0/admin/devices/migrations", s.admin(s.MigrateDevice))
+	router.Handle(http.MethodGet, "/api/v0/admin/devices/{id}/audit", s.admin(s.GetAuditTrail))
+
+	// flat v0 routes, kept as aliases of the device resources
+	router.Handle(http.MethodPost, "/api/v0/device", s.CreateSignatureDevice)
+	router.Handle(http.MethodPost, "/api/v0/sign", s.SignTransaction)
+
+	router.Handle(http.MethodGet, JWKSPath, s.JWKS)
+	router.Handle(http.MethodHead, JWKSPath, s.JWKS)
+	router.Handle(http.MethodGet, "/metrics", s.Metrics)
+
+	return router
+}
 
-	return http.ListenAndServe(s.listenAddress, mux)
+// decodeRequest decodes and validates the JSON body of the request into v.
+// If that fails, it responds to the client with a 400 status code and returns false.
+func (s *Server) decodeRequest(response http.ResponseWriter, request *http.Request, handler string, v interface{}) bool {
+	err := json.NewDecoder(request.Body).Decode(v)
+	if err == nil {
+		err = s.v.Struct(v)
+	}
+	if err != nil {
+		log.Printf("[WARNING][%s] decode error %v", handler, err)
+		WriteErrorResponse(response, http.StatusBadRequest, []string{
+			"Invalid request body was sent",
+		})
+
+		return false
+	}
+
+	return true
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -57,9 +124,15 @@ func WriteInternalError(w http.ResponseWriter) {
 // WriteErrorResponse takes an HTTP status code and a slice of errors
 // and writes those as an HTTP error response in a structured format.
 func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
+	WriteErrorCodeResponse(w, code, "", errors)
+}
+
+// WriteErrorCodeResponse writes an HTTP error response like WriteErrorResponse, tagged with an error code.
+func WriteErrorCodeResponse(w http.ResponseWriter, code int, errorCode string, errors []string) {
 	w.WriteHeader(code)
 
 	errorResponse := ErrorResponse{
+		Code:   errorCode,
 		Errors: errors,
 	}
 
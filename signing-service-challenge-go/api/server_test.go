@@ -0,0 +1,74 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+// newServer returns a server backed by an in-memory repository that signs and verifies with ECDSA devices.
+func newServer() (*api.Server, service.Signature) {
+	factory := service.NewAlgorithmFactoryV0()
+	factory.Add(domain.ECDSA, func(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+		keyPair, err := crypto.NewECCMarshaller().UnMarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.NewECCSigner(keyPair.(*crypto.ECCKeyPair), ecdsaConfig(device)), nil
+	})
+
+	verifiers := service.NewVerifierFactoryV0()
+	verifiers.Add(domain.ECDSA, func(device domain.Device, publicKey []byte) (crypto.Verifier, error) {
+		keyPair, err := crypto.NewECCMarshaller().UnMarshalPublic(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.NewECCVerifier(keyPair.(*crypto.ECCKeyPair), ecdsaConfig(device)), nil
+	})
+
+	signature := service.NewV0Signature(persistence.NewInMemoryRepository(&sync.RWMutex{}), factory,
+		service.WithVerifierFactory(verifiers))
+
+	return api.NewServer("", signature), signature
+}
+
+// ecdsaConfig encodes the signatures of the device as it requests.
+func ecdsaConfig(device domain.Device) crypto.Config {
+	if device.Encoding == domain.EncodingP1363 {
+		return crypto.Config{ECDSAEncoding: crypto.ECDSAEncodingP1363}
+	}
+
+	return crypto.Config{}
+}
+
+// createDevice creates an active ECDSA device through the service.
+func createDevice(t *testing.T, signature service.Signature) uuid.UUID {
+	t.Helper()
+
+	deviceID, err := signature.CreateDevice(context.Background(), domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return deviceID
+}
+
+// serve sends the request to the routes of the server and returns the recorded response.
+func serve(server *api.Server, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(recorder, request)
+
+	return recorder
+}
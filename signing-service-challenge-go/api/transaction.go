@@ -1,9 +1,7 @@
 package api
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 
@@ -17,49 +15,53 @@ type SignRequest struct {
 	Data     string    `json:"data"`
 }
 
+type CreateSignatureRequest struct {
+	Data string `json:"data"`
+}
+
 type SignResp struct {
-	Signature     string `json:"signature"`
-	SignatureData string `json:"signature_data"`
+	Signature  string `json:"signature"`
+	SignedData string `json:"signed_data"`
+	// KeyVersion is the version of the device key that signed, its JWK has the kid <device id>:<version>.
+	KeyVersion int `json:"key_version"`
 }
 
 func ToSignResp(transaction domain.SignedTransaction) SignResp {
 	return SignResp{
-		Signature:     transaction.Signature,
-		SignatureData: fmt.Sprintf("%d_%s_%s", transaction.Counter, transaction.RawData, transaction.LastSignature),
+		Signature:  transaction.Signature,
+		SignedData: transaction.SignedData,
+		KeyVersion: transaction.KeyVersion,
 	}
 }
 
 // SignTransaction signs provided data with set earlier algorithm
 func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Request) {
-	if request.Method != http.MethodPost {
-		WriteMethodNotAllowed(response)
+	var device SignRequest
+
+	if !s.decodeRequest(response, request, "SignTransaction", &device) {
 		return
 	}
 
-	var device SignRequest
-
-	// Try to decode the request body into the struct. If there is an error,
-	// respond to the client with the error message and a 400 status code.
-	err := json.NewDecoder(request.Body).Decode(&device)
+	s.sign(response, request, device.DeviceID, device.Data)
+}
 
-	if err != nil {
-		log.Println("[WARNING][SignTransaction] decode error", err)
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Invalid request body was sent",
-		})
+// CreateSignature signs provided data with the device of the path
+func (s *Server) CreateSignature(response http.ResponseWriter, request *http.Request) {
+	deviceID, ok := deviceIDParam(response, request)
+	if !ok {
 		return
 	}
 
-	err = s.v.Struct(&device)
-	if err != nil {
-		log.Println("[WARNING][SignTransaction] decode error", err)
-		WriteErrorResponse(response, http.StatusBadRequest, []string{
-			"Invalid request body was sent",
-		})
+	var signature CreateSignatureRequest
+	if !s.decodeRequest(response, request, "CreateSignature", &signature) {
 		return
 	}
 
-	resp, err := s.signature.SignTx(request.Context(), device.DeviceID, device.Data)
+	s.sign(response, request, deviceID, signature.Data)
+}
+
+func (s *Server) sign(response http.ResponseWriter, request *http.Request, deviceID uuid.UUID, data string) {
+	resp, err := s.signature.SignTx(request.Context(), deviceID, data)
 	if err != nil {
 		log.Println("[WARN][SignTransaction] error", err)
 		if errors.Is(err, domain.ErrDeviceNotFound) {
@@ -69,6 +71,13 @@ func (s *Server) SignTransaction(response http.ResponseWriter, request *http.Req
 
 			return
 		}
+		if errors.Is(err, domain.ErrDeviceNotActive) {
+			WriteErrorCodeResponse(response, http.StatusConflict, CodeDeviceNotActive, []string{
+				domain.ErrDeviceNotActive.Error(),
+			})
+
+			return
+		}
 
 		WriteInternalError(response)
 
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type VerifyRequest struct {
+	DeviceID   uuid.UUID `json:"device_id" validate:"required"`
+	SignedData string    `json:"signed_data" validate:"required"`
+	Signature  string    `json:"signature" validate:"required"`
+}
+
+// VerifySignature checks a signature created by a device against its public key
+func (s *Server) VerifySignature(response http.ResponseWriter, request *http.Request) {
+	var verify VerifyRequest
+
+	if !s.decodeRequest(response, request, "VerifySignature", &verify) {
+		return
+	}
+
+	res, err := s.signature.Verify(request.Context(), verify.DeviceID, verify.SignedData, verify.Signature)
+	if err != nil {
+		writeDeviceError(response, "VerifySignature", err)
+
+		return
+	}
+
+	WriteAPIResponse(response, http.StatusOK, res)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+// Exit codes of the verify-chain and rewrap-keys commands.
+const (
+	exitChainValid  = 0
+	exitChainBroken = 1
+	exitUsage       = 2
+
+	exitRewrapped    = 0
+	exitRewrapFailed = 1
+)
+
+// verifyChain checks a signature chain exported by GET /api/v0/devices/{id}/chain/export offline:
+//
+//	signing-service verify-chain -file <export.json> -fingerprint <sha256> [-public-key <key.pem>] [-data <data.json>]
+//
+// The export carries the public keys its signatures are checked with, so each of them has to match a key the
+// auditor obtained independently: a PEM file given by -public-key or a SHA-256 fingerprint given by -fingerprint,
+// both can be repeated for devices with rotated keys. It prints the report as JSON with the fingerprint of every
+// key version and exits with 1 if a key isn't pinned or the chain is broken.
+// Journals kept with JOURNAL_DATA=hash don't contain the transaction data, -data supplies it as a JSON object of
+// the data by counter, e.g. {"0": "receipt"}. Signatures of entries without data are counted as unverified.
+func verifyChain(args []string, stdout, stderr io.Writer) int {
+	var publicKeyFiles, fingerprints stringList
+
+	flags := flag.NewFlagSet("verify-chain", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	file := flags.String("file", "", "chain export of a device, - reads stdin")
+	flags.Var(&publicKeyFiles, "public-key", "PEM file of a trusted public key of the device, can be repeated")
+	flags.Var(&fingerprints, "fingerprint", "hex SHA-256 fingerprint of a trusted public key of the device, can be repeated")
+	dataFile := flags.String("data", "", "JSON object of the transaction data by counter, for journals that only keep its hash")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *file == "" || len(publicKeyFiles)+len(fingerprints) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	var (
+		input io.Reader = os.Stdin
+		err   error
+	)
+	if *file != "-" {
+		f, errOpen := os.Open(*file)
+		if errOpen != nil {
+			fmt.Fprintln(stderr, errOpen)
+			return exitUsage
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var document api.ChainExportResponse
+	if err = json.NewDecoder(input).Decode(&document); err != nil {
+		fmt.Fprintln(stderr, "invalid export:", err)
+		return exitUsage
+	}
+
+	export, err := document.ConvertToDomain()
+	if err != nil {
+		fmt.Fprintln(stderr, "invalid export:", err)
+		return exitUsage
+	}
+
+	pinned := make(map[string]bool, len(publicKeyFiles)+len(fingerprints))
+	for _, fingerprint := range fingerprints {
+		pinned[normalizeFingerprint(fingerprint)] = true
+	}
+	for _, path := range publicKeyFiles {
+		fingerprint, errPin := fileFingerprint(export.Device, path)
+		if errPin != nil {
+			fmt.Fprintf(stderr, "invalid public key %s: %v\n", path, errPin)
+			return exitUsage
+		}
+		pinned[fingerprint] = true
+	}
+
+	result := chainVerification{KeyFingerprints: make(map[int]string, len(export.PublicKeys))}
+	verifiers := make(map[int]crypto.Verifier, len(export.PublicKeys))
+	for version, publicKeyPEM := range export.PublicKeys {
+		publicKey, errParse := crypto.ParsePEMPublicKey(export.Device, publicKeyPEM)
+		if errParse != nil {
+			fmt.Fprintf(stderr, "invalid public key of version %d: %v\n", version, errParse)
+			return exitUsage
+		}
+
+		if result.KeyFingerprints[version], err = publicKey.Fingerprint(); err != nil {
+			fmt.Fprintf(stderr, "invalid public key of version %d: %v\n", version, err)
+			return exitUsage
+		}
+		if verifiers[version], err = crypto.NewPublicKeyVerifier(publicKey, signerConfig(export.Device)); err != nil {
+			fmt.Fprintf(stderr, "invalid public key of version %d: %v\n", version, err)
+			return exitUsage
+		}
+	}
+
+	// a forged export re-signed with another key is only caught by the keys the auditor trusts
+	for version, fingerprint := range result.KeyFingerprints {
+		if !pinned[fingerprint] {
+			fmt.Fprintf(stderr, "public key of version %d with fingerprint %s isn't trusted\n", version, fingerprint)
+			return exitChainBroken
+		}
+	}
+
+	var data map[int64]string
+	if *dataFile != "" {
+		if data, err = readData(*dataFile); err != nil {
+			fmt.Fprintln(stderr, "invalid data:", err)
+			return exitUsage
+		}
+	}
+
+	result.ChainReport = service.VerifyExport(export, verifiers, data)
+	if result.UnverifiedSignatures > 0 {
+		fmt.Fprintf(stderr, "%d signatures aren't verified, the journal only keeps the hash of their data, supply it with -data\n",
+			result.UnverifiedSignatures)
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	if !result.Valid {
+		return exitChainBroken
+	}
+
+	return exitChainValid
+}
+
+// chainVerification is the output of verify-chain.
+type chainVerification struct {
+	domain.ChainReport
+	// KeyFingerprints are the hex encoded SHA-256 fingerprints of the exported public keys by key version.
+	KeyFingerprints map[int]string `json:"key_fingerprints"`
+}
+
+// readData reads the transaction data by counter from a JSON object like {"0": "receipt"}.
+func readData(path string) (map[int64]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data map[int64]string
+	if err = json.NewDecoder(f).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// fileFingerprint returns the fingerprint of the PEM encoded public key of the device in the file.
+func fileFingerprint(device domain.Device, path string) (string, error) {
+	publicKeyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	publicKey, err := crypto.ParsePEMPublicKey(device, publicKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	return publicKey.Fingerprint()
+}
+
+// normalizeFingerprint accepts fingerprints in upper case and with colon separated bytes.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+
+	return nil
+}
+
+// rewrapKeys wraps the data keys of all stored private keys with the current master key and seals keys
+// stored before encryption was enabled. It reads the same STORAGE and KEK settings as the server:
+//
+//	KEK_KEYS=old:...,new:... signing-service rewrap-keys
+//
+// The replaced master keys can be removed once it succeeded.
+func rewrapKeys(stdout, stderr io.Writer) int {
+	kek := keyEncryption()
+	if kek == nil {
+		fmt.Fprintln(stderr, "set KEK_FILE or KEK_KEYS")
+		return exitUsage
+	}
+
+	repo := repository()
+	if closer, ok := repo.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	signature := service.NewV0Signature(repo, service.NewSealedAlgorithmFactory(signerFactory(), kek),
+		service.WithKeyEncryption(kek),
+	)
+
+	rewrapped, err := signature.RewrapKeys(context.Background())
+	fmt.Fprintf(stdout, "rewrapped %d device keys with master key %q\n", rewrapped, kek.CurrentKeyID())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitRewrapFailed
+	}
+
+	return exitRewrapped
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+const (
+	// DefaultKeyPoolDepth is the number of ready key pairs per algorithm/parameter combination.
+	DefaultKeyPoolDepth = 2
+	// DefaultSignerCacheSize is the number of parsed signers kept in memory.
+	DefaultSignerCacheSize = 1024
+)
+
+// keyPoolConfigs returns a pool config for every combination of the key policy.
+// The depth is read from KEY_POOL_DEPTH and can be overridden per combination,
+// e.g. KEY_POOL_DEPTH_RSA_4096=8 or KEY_POOL_DEPTH_ECDSA_P256=0 to disable the pool.
+func keyPoolConfigs(policy domain.KeyPolicy) []crypto.KeyPoolConfig {
+	configs := crypto.PoolConfigs(policy, envInt("KEY_POOL_DEPTH", DefaultKeyPoolDepth))
+	for i := range configs {
+		configs[i].Depth = envInt("KEY_POOL_DEPTH_"+configs[i].Name(), configs[i].Depth)
+	}
+
+	return configs
+}
+
+// DefaultSQLitePath is the database file of the sqlite storage.
+const DefaultSQLitePath = "signing-service.db"
+
+// repository opens the storage selected by STORAGE: memory (default), sqlite or postgres.
+// SQLite keeps its data in the file SQLITE_PATH. PostgreSQL is configured by POSTGRES_DSN and the pool
+// settings POSTGRES_MAX_OPEN_CONNS, POSTGRES_MAX_IDLE_CONNS, POSTGRES_CONN_MAX_LIFETIME and
+// POSTGRES_CONN_MAX_IDLE_TIME, e.g. 5m. The same settings with the prefix SQLITE apply to SQLite.
+func repository() persistence.DeviceSignatureRepository {
+	switch storage := os.Getenv("STORAGE"); storage {
+	case "", "memory":
+		return persistence.NewInMemoryRepository(&sync.RWMutex{})
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = DefaultSQLitePath
+		}
+		repo, err := persistence.OpenSQLite(path, poolConfig("SQLITE"))
+		if err != nil {
+			log.Fatalf("could not open sqlite: %v", err)
+		}
+		return repo
+	case "postgres":
+		repo, err := persistence.OpenPostgres(os.Getenv("POSTGRES_DSN"), poolConfig("POSTGRES"))
+		if err != nil {
+			log.Fatalf("could not open postgres: %v", err)
+		}
+		return repo
+	default:
+		log.Fatalf("invalid value of STORAGE: %q", storage)
+		return nil
+	}
+}
+
+// keyEncryption returns the master keys private keys are sealed with, nil if none are configured.
+// KEK_FILE names a JSON file of master keys, see crypto.NewFileKeyProvider. Otherwise KEK_KEYS lists them as
+// comma separated id:base64 pairs and KEK_CURRENT selects the one new keys are wrapped with, the last by default.
+func keyEncryption() crypto.KeyEncryptionKeyProvider {
+	if path := os.Getenv("KEK_FILE"); path != "" {
+		provider, err := crypto.NewFileKeyProvider(path)
+		if err != nil {
+			log.Fatalf("could not read KEK_FILE: %v", err)
+		}
+		return provider
+	}
+
+	if keys := os.Getenv("KEK_KEYS"); keys != "" {
+		provider, err := crypto.NewEnvKeyProvider(keys, os.Getenv("KEK_CURRENT"))
+		if err != nil {
+			log.Fatalf("invalid value of KEK_KEYS: %v", err)
+		}
+		return provider
+	}
+
+	log.Println("[WARN][keyEncryption] no master key configured, private keys are stored unencrypted")
+
+	return nil
+}
+
+// adminTokens reads ADMIN_TOKENS, comma separated name:token pairs of the bearer tokens of the admin routes.
+// The name of the admin is recorded in the audit trail.
+func adminTokens() map[string]string {
+	tokens, err := api.ParseAdminTokens(os.Getenv("ADMIN_TOKENS"))
+	if err != nil {
+		log.Fatalf("invalid value of ADMIN_TOKENS: %v", err)
+	}
+
+	return tokens
+}
+
+// pkcs11Token opens the PKCS#11 token devices with the key storage pkcs11 keep their keys on, nil if
+// PKCS11_MODULE isn't set. PKCS11_TOKEN_LABEL selects the token, PKCS11_PIN is the user PIN and
+// PKCS11_SESSIONS the number of concurrent operations on the token.
+func pkcs11Token() *crypto.PKCS11Token {
+	module := os.Getenv("PKCS11_MODULE")
+	if module == "" {
+		return nil
+	}
+
+	token, err := crypto.OpenPKCS11Token(crypto.PKCS11Config{
+		Module:     module,
+		TokenLabel: os.Getenv("PKCS11_TOKEN_LABEL"),
+		PIN:        os.Getenv("PKCS11_PIN"),
+		Sessions:   envInt("PKCS11_SESSIONS", crypto.DefaultPKCS11Sessions),
+	})
+	if err != nil {
+		log.Fatalf("could not open PKCS#11 token: %v", err)
+	}
+
+	return token
+}
+
+// poolConfig reads the connection pool settings with the prefix.
+func poolConfig(prefix string) persistence.PoolConfig {
+	return persistence.PoolConfig{
+		MaxOpenConns:    envInt(prefix+"_MAX_OPEN_CONNS", 0),
+		MaxIdleConns:    envInt(prefix+"_MAX_IDLE_CONNS", 0),
+		ConnMaxLifetime: envDuration(prefix+"_CONN_MAX_LIFETIME", 0),
+		ConnMaxIdleTime: envDuration(prefix+"_CONN_MAX_IDLE_TIME", 0),
+	}
+}
+
+// journalData reads JOURNAL_DATA, "hash" keeps only the SHA-256 hash of the transaction data in the journal and
+// replaces the data in the stored secured data by its hash. Chain checks of such a journal verify the signatures
+// only with the data supplied, e.g. by verify-chain -data.
+func journalData() service.JournalData {
+	switch value := os.Getenv("JOURNAL_DATA"); value {
+	case "", "raw":
+		return service.JournalRawData
+	case "hash":
+		return service.JournalDataHash
+	default:
+		log.Fatalf("invalid value of JOURNAL_DATA: %q", value)
+		return service.JournalRawData
+	}
+}
+
+// envInt reads an integer environment variable, fallback is used if it isn't set.
+func envInt(name string, fallback int) int {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid value of %s: %v", name, err)
+	}
+
+	return n
+}
+
+// envDuration reads a duration environment variable like 30s, fallback is used if it isn't set.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid value of %s: %v", name, err)
+	}
+
+	return d
+}
@@ -0,0 +1,38 @@
+// Package cryptotest provides key material for the tests of packages using crypto.
+package cryptotest
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// MasterKey returns a random master key.
+func MasterKey(t *testing.T) []byte {
+	t.Helper()
+
+	key := make([]byte, crypto.MasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// KeyProvider returns a provider of a random master key for each of the ids, it seals with the key current.
+func KeyProvider(t *testing.T, current string, ids ...string) *crypto.LocalKeyProvider {
+	t.Helper()
+
+	keys := make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = MasterKey(t)
+	}
+
+	provider, err := crypto.NewLocalKeyProvider(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
@@ -73,3 +73,25 @@ func (m ECCMarshaler) UnMarshal(privateKeyBytes []byte) (keyPair interface{}, er
 		Public:  &privateKey.PublicKey,
 	}, nil
 }
+
+// UnMarshalPublic assembles an ECCKeyPair without private key from an encoded public key.
+func (m ECCMarshaler) UnMarshalPublic(publicKeyBytes []byte) (keyPair interface{}, err error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrWrongKeyPairTypeECC
+	}
+
+	return &ECCKeyPair{
+		Public: publicKey,
+	}, nil
+}
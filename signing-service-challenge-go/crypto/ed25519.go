@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrWrongKeyPairTypeEd25519 = fmt.Errorf("Ed25519 %w", ErrWrongKeyPairType)
+	ErrInvalidPEM              = errors.New("no PEM data found")
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Ed25519Marshaler can encode and decode an Ed25519 key pair.
+type Ed25519Marshaler struct{}
+
+// NewEd25519Marshaller creates a new Ed25519Marshaler.
+func NewEd25519Marshaller() KeyPairMarshaller {
+	return &Ed25519Marshaler{}
+}
+
+// Marshal takes an Ed25519KeyPair and encodes the private key as PKCS#8 and the public key as PKIX.
+// It returns the public and the private key as a PEM encoded byte slice.
+func (m Ed25519Marshaler) Marshal(keyPair interface{}) (public, private []byte, err error) {
+	v, ok := keyPair.(*Ed25519KeyPair)
+	if !ok {
+		err = ErrWrongKeyPairTypeEd25519
+
+		return
+	}
+
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(v.Private)
+	if err != nil {
+		return
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(v.Public)
+	if err != nil {
+		return
+	}
+
+	private = pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	public = pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return
+}
+
+// UnMarshal assembles an Ed25519KeyPair from a PEM encoded PKCS#8 private key.
+func (m Ed25519Marshaler) UnMarshal(privateKeyBytes []byte) (keyPair interface{}, err error) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrWrongKeyPairTypeEd25519
+	}
+
+	return &Ed25519KeyPair{
+		Private: privateKey,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// UnMarshalPublic assembles an Ed25519KeyPair without private key from a PEM encoded PKIX public key.
+func (m Ed25519Marshaler) UnMarshalPublic(publicKeyBytes []byte) (keyPair interface{}, err error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrWrongKeyPairTypeEd25519
+	}
+
+	return &Ed25519KeyPair{
+		Public: publicKey,
+	}, nil
+}
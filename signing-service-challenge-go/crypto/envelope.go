@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const sealedKeyVersion = 1
+
+// DataKeySize is the size of the AES-256 data key every private key is sealed with.
+const DataKeySize = 32
+
+var ErrInvalidSealedKey = errors.New("sealed key can't be decrypted")
+
+// sealedKey is the envelope a private key is stored in. The private key is encrypted with its own data key,
+// bound to the device ID, and the data key is wrapped by the master key KeyID of a KeyEncryptionKeyProvider.
+type sealedKey struct {
+	Version int    `json:"v"`
+	KeyID   string `json:"kek"`
+	DataKey []byte `json:"dek"`
+	Key     []byte `json:"key"`
+}
+
+// sealedPrefix starts every envelope, PEM encoded keys start with "-----BEGIN".
+var sealedPrefix = []byte(`{"v":`)
+
+// IsSealedPrivateKey reports whether the stored private key is an envelope created by SealPrivateKey.
+func IsSealedPrivateKey(privateKey []byte) bool {
+	return bytes.HasPrefix(privateKey, sealedPrefix)
+}
+
+// SealPrivateKey encrypts the private key of the device with a new data key wrapped by the current master key.
+func SealPrivateKey(provider KeyEncryptionKeyProvider, deviceID uuid.UUID, privateKey []byte) ([]byte, error) {
+	dataKey := make([]byte, DataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer Wipe(dataKey)
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := seal(aead, privateKey, deviceID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := provider.CurrentKeyID()
+	wrapped, err := provider.WrapKey(keyID, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+
+	return json.Marshal(sealedKey{Version: sealedKeyVersion, KeyID: keyID, DataKey: wrapped, Key: key})
+}
+
+// OpenPrivateKey decrypts a private key sealed by SealPrivateKey for the device.
+// Keys stored before encryption was enabled aren't envelopes and are returned as they are.
+func OpenPrivateKey(provider KeyEncryptionKeyProvider, deviceID uuid.UUID, privateKey []byte) ([]byte, error) {
+	if !IsSealedPrivateKey(privateKey) {
+		return privateKey, nil
+	}
+
+	envelope, err := parseSealedKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := provider.UnwrapKey(envelope.KeyID, envelope.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	defer Wipe(dataKey)
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, envelope.Key, deviceID[:])
+}
+
+// RewrapPrivateKey wraps the data key of a sealed private key with the current master key, the private key
+// itself is not decrypted. Keys stored before encryption was enabled are sealed. It returns privateKey
+// unchanged if it is already wrapped with the current master key.
+func RewrapPrivateKey(provider KeyEncryptionKeyProvider, deviceID uuid.UUID, privateKey []byte) ([]byte, error) {
+	if !IsSealedPrivateKey(privateKey) {
+		return SealPrivateKey(provider, deviceID, privateKey)
+	}
+
+	envelope, err := parseSealedKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	current := provider.CurrentKeyID()
+	if envelope.KeyID == current {
+		return privateKey, nil
+	}
+
+	dataKey, err := provider.UnwrapKey(envelope.KeyID, envelope.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	defer Wipe(dataKey)
+
+	if envelope.DataKey, err = provider.WrapKey(current, dataKey); err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	envelope.KeyID = current
+
+	return json.Marshal(envelope)
+}
+
+// SealedKeyID returns the ID of the master key the sealed private key is wrapped with.
+func SealedKeyID(privateKey []byte) (string, error) {
+	envelope, err := parseSealedKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return envelope.KeyID, nil
+}
+
+func parseSealedKey(privateKey []byte) (sealedKey, error) {
+	var envelope sealedKey
+	if err := json.Unmarshal(privateKey, &envelope); err != nil || envelope.Version != sealedKeyVersion {
+		return sealedKey{}, ErrInvalidSealedKey
+	}
+
+	return envelope, nil
+}
+
+// Wipe overwrites key material that is no longer needed.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -10,15 +11,14 @@ import (
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
-const bits = 4096
+// DefaultRSABits is the modulus length of RSAGenerator when no size is set.
+const DefaultRSABits = 4096
 
-var (
-	eccGenerator = &ECCGenerator{}
-	rsaGenerator = &RSAGenerator{}
-)
+var ed25519Generator = &Ed25519Generator{}
 
 var (
 	ErrWrongAlgorithmType = errors.New("wrong type of Algorithm")
+	ErrUnknownCurve       = errors.New("unknown curve")
 )
 
 type KeyPair interface {
@@ -26,11 +26,19 @@ type KeyPair interface {
 }
 
 // RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{}
+type RSAGenerator struct {
+	// Bits is the modulus length, DefaultRSABits if zero.
+	Bits int
+}
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 	// Security has been ignored for the sake of simplicity.
+	bits := g.Bits
+	if bits == 0 {
+		bits = DefaultRSABits
+	}
+
 	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
@@ -43,12 +51,20 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 }
 
 // ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+type ECCGenerator struct {
+	// Curve is the elliptic curve of the key, P-384 if nil.
+	Curve elliptic.Curve
+}
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	curve := g.Curve
+	if curve == nil {
+		curve = elliptic.P384()
+	}
+
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -59,9 +75,42 @@ func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 	}, nil
 }
 
-func GetKeyPair(algorithm domain.Algorithm) (public, private []byte, err error) {
-	switch algorithm {
-	case domain.RSA:
+// Ed25519Generator generates an Ed25519 key pair.
+type Ed25519Generator struct{}
+
+// Generate generates a new Ed25519KeyPair.
+func (g *Ed25519Generator) Generate() (*Ed25519KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519KeyPair{
+		Public:  public,
+		Private: private,
+	}, nil
+}
+
+// EllipticCurve returns the elliptic.Curve of a curve name.
+func EllipticCurve(curve domain.Curve) (elliptic.Curve, error) {
+	switch curve {
+	case domain.CurveP256:
+		return elliptic.P256(), nil
+	case domain.CurveP384:
+		return elliptic.P384(), nil
+	case domain.CurveP521:
+		return elliptic.P521(), nil
+	default:
+		return nil, ErrUnknownCurve
+	}
+}
+
+// GetKeyPair generates a key pair for the algorithm and the key parameters of the device
+// and returns it PEM encoded.
+func GetKeyPair(device domain.Device) (public, private []byte, err error) {
+	switch device.Algorithm {
+	case domain.RSAPKCS1SHA256, domain.RSAPSSSHA256:
+		rsaGenerator := &RSAGenerator{Bits: device.KeySize}
 		k, errGenerator := rsaGenerator.Generate()
 		if errGenerator != nil {
 			err = errGenerator
@@ -72,6 +121,14 @@ func GetKeyPair(algorithm domain.Algorithm) (public, private []byte, err error)
 		marshaller := NewRSAMarshaller()
 		return marshaller.Marshal(k)
 	case domain.ECDSA:
+		curve, errCurve := EllipticCurve(device.Curve)
+		if errCurve != nil {
+			err = errCurve
+
+			return
+		}
+
+		eccGenerator := &ECCGenerator{Curve: curve}
 		k, errGenerator := eccGenerator.Generate()
 		if errGenerator != nil {
 			err = errGenerator
@@ -81,6 +138,16 @@ func GetKeyPair(algorithm domain.Algorithm) (public, private []byte, err error)
 
 		marshaller := NewECCMarshaller()
 		return marshaller.Marshal(k)
+	case domain.Ed25519:
+		k, errGenerator := ed25519Generator.Generate()
+		if errGenerator != nil {
+			err = errGenerator
+
+			return
+		}
+
+		marshaller := NewEd25519Marshaller()
+		return marshaller.Marshal(k)
 	default:
 		err = ErrWrongAlgorithmType
 		return
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+var (
+	ErrInvalidPrivateKey  = errors.New("private key can't be parsed")
+	ErrPassphraseRequired = errors.New("private key is encrypted, a passphrase is required")
+)
+
+// ImportedKeyPair is an existing key pair, encoded like the key pairs GetKeyPair generates,
+// together with the key parameters read from the key.
+type ImportedKeyPair struct {
+	Curve   domain.Curve
+	KeySize int
+
+	Public  []byte
+	Private []byte
+}
+
+// ImportKeyPair parses an existing PEM encoded private key for a device of the algorithm. It accepts
+// PKCS#8 ("PRIVATE KEY"), SEC1 ("EC PRIVATE KEY"), PKCS#1 ("RSA PRIVATE KEY") and PBES2 encrypted
+// PKCS#8 ("ENCRYPTED PRIVATE KEY"), which is decrypted with the passphrase.
+// A key of another type than the algorithm returns domain.ErrKeyAlgorithmMismatch.
+func ImportKeyPair(algorithm domain.Algorithm, pemBytes, passphrase []byte) (ImportedKeyPair, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return ImportedKeyPair{}, ErrInvalidPEM
+	}
+	defer Wipe(block.Bytes)
+
+	key, err := parsePrivateKey(block, passphrase)
+	if err != nil {
+		return ImportedKeyPair{}, err
+	}
+
+	var (
+		imported   ImportedKeyPair
+		marshaller KeyPairMarshaller
+		keyPair    interface{}
+	)
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != domain.RSAPKCS1SHA256 && algorithm != domain.RSAPSSSHA256 {
+			return ImportedKeyPair{}, fmt.Errorf("%w: RSA key", domain.ErrKeyAlgorithmMismatch)
+		}
+		if err = k.Validate(); err != nil {
+			return ImportedKeyPair{}, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+		}
+		imported.KeySize = k.N.BitLen()
+		marshaller, keyPair = NewRSAMarshaller(), &RSAKeyPair{Public: &k.PublicKey, Private: k}
+	case *ecdsa.PrivateKey:
+		if algorithm != domain.ECDSA {
+			return ImportedKeyPair{}, fmt.Errorf("%w: ECDSA key", domain.ErrKeyAlgorithmMismatch)
+		}
+		imported.Curve = domain.Curve(k.Curve.Params().Name)
+		marshaller, keyPair = NewECCMarshaller(), &ECCKeyPair{Public: &k.PublicKey, Private: k}
+	case ed25519.PrivateKey:
+		if algorithm != domain.Ed25519 {
+			return ImportedKeyPair{}, fmt.Errorf("%w: Ed25519 key", domain.ErrKeyAlgorithmMismatch)
+		}
+		marshaller, keyPair = NewEd25519Marshaller(), &Ed25519KeyPair{Public: k.Public().(ed25519.PublicKey), Private: k}
+	default:
+		return ImportedKeyPair{}, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPrivateKey, key)
+	}
+
+	if imported.Public, imported.Private, err = marshaller.Marshal(keyPair); err != nil {
+		return ImportedKeyPair{}, err
+	}
+
+	return imported, nil
+}
+
+func parsePrivateKey(block *pem.Block, passphrase []byte) (interface{}, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		key, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, passphrase)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		// legacy OpenSSL encryption of PKCS#1 keys is insecure and not supported, keys have to be converted to PKCS#8
+		if _, encrypted := block.Headers["DEK-Info"]; encrypted {
+			return nil, fmt.Errorf("%w: encrypted PKCS#1 keys aren't supported, use encrypted PKCS#8", ErrInvalidPrivateKey)
+		}
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM type %q", ErrInvalidPrivateKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	return key, nil
+}
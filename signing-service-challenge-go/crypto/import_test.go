@@ -0,0 +1,109 @@
+package crypto_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestImportKeyPair(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := pkcs8.MarshalPrivateKey(ecKey, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		algorithm  domain.Algorithm
+		pem        []byte
+		passphrase string
+		curve      domain.Curve
+		keySize    int
+		err        error
+	}{
+		{"PKCS#8 ECDSA", domain.ECDSA, encodePKCS8(t, ecKey), "", domain.CurveP256, 0, nil},
+		{"SEC1", domain.ECDSA, encodePEM("EC PRIVATE KEY", sec1), "", domain.CurveP256, 0, nil},
+		{"PKCS#8 RSA", domain.RSAPSSSHA256, encodePKCS8(t, rsaKey), "", "", 2048, nil},
+		{"PKCS#1", domain.RSAPKCS1SHA256, encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), "", "", 2048, nil},
+		{"PKCS#8 Ed25519", domain.Ed25519, encodePKCS8(t, edKey), "", "", 0, nil},
+		{"encrypted PKCS#8", domain.ECDSA, encodePEM("ENCRYPTED PRIVATE KEY", encrypted), "secret", domain.CurveP256, 0, nil},
+		{"wrong passphrase", domain.ECDSA, encodePEM("ENCRYPTED PRIVATE KEY", encrypted), "wrong", "", 0, crypto.ErrInvalidPrivateKey},
+		{"missing passphrase", domain.ECDSA, encodePEM("ENCRYPTED PRIVATE KEY", encrypted), "", "", 0, crypto.ErrPassphraseRequired},
+		{"algorithm mismatch", domain.RSAPKCS1SHA256, encodePKCS8(t, ecKey), "", "", 0, domain.ErrKeyAlgorithmMismatch},
+		{"public key", domain.ECDSA, encodePEM("PUBLIC KEY", []byte("key")), "", "", 0, crypto.ErrInvalidPrivateKey},
+		{"no PEM", domain.ECDSA, []byte("key"), "", "", 0, crypto.ErrInvalidPEM},
+	}
+
+	for _, tt := range tests {
+		imported, err := crypto.ImportKeyPair(tt.algorithm, tt.pem, []byte(tt.passphrase))
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("%s: expected %v, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if imported.Curve != tt.curve || imported.KeySize != tt.keySize {
+			t.Fatalf("%s: unexpected key parameters %s %d", tt.name, imported.Curve, imported.KeySize)
+		}
+
+		// the imported key is stored like a generated one
+		marshaller, err := crypto.NewMarshaller(tt.algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = marshaller.UnMarshal(imported.Private); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, err = crypto.ParsePublicKey(domain.Device{Algorithm: tt.algorithm}, imported.Public); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func encodePKCS8(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encodePEM("PRIVATE KEY", der)
+}
+
+func encodePEM(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// JWK is a public JSON Web Key (RFC 7517) with the members of RSA, EC and OKP keys.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set (RFC 7517, section 5).
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the key as JSON Web Key, alg is the JWA name of the signature algorithm of the device.
+// JWS ES* verifiers expect the fixed-width r||s form, so ECDSA keys only get an alg if the device
+// signs with EncodingP1363; the ASN.1 DER signatures of the other ECDSA devices aren't JOSE-compatible.
+func (p PublicKey) JWK() (JWK, error) {
+	jwk := JWK{Use: "sig"}
+
+	switch k := p.Key.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64URL(k.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(k.E)).Bytes())
+		jwk.Alg = "RS256"
+		if p.Algorithm == domain.RSAPSSSHA256 {
+			jwk.Alg = "PS256"
+		}
+	case *ecdsa.PublicKey:
+		size := curveSize(k.Curve)
+		x, y := make([]byte, size), make([]byte, size)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64URL(x)
+		jwk.Y = base64URL(y)
+		if p.Encoding != domain.EncodingP1363 {
+			break
+		}
+		switch size {
+		case 32:
+			jwk.Alg = "ES256"
+		case 48:
+			jwk.Alg = "ES384"
+		default:
+			jwk.Alg = "ES512"
+		}
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64URL(k)
+		jwk.Alg = "EdDSA"
+	default:
+		return JWK{}, ErrWrongKeyPairType
+	}
+
+	return jwk, nil
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
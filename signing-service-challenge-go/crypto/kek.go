@@ -0,0 +1,185 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MasterKeySize is the size of the AES-256 master keys of a LocalKeyProvider.
+const MasterKeySize = 32
+
+var (
+	ErrUnknownMasterKey = errors.New("unknown master key")
+	ErrInvalidMasterKey = errors.New("master keys must be 32 bytes")
+)
+
+// KeyEncryptionKeyProvider wraps the data keys of private keys with a master key it never hands out.
+// It holds the current master key and the keys it replaced, so data keys wrapped before a rotation can
+// still be unwrapped until they are re-wrapped. A KMS can implement it with its encrypt and decrypt calls.
+type KeyEncryptionKeyProvider interface {
+	// CurrentKeyID returns the ID of the master key new data keys are wrapped with.
+	CurrentKeyID() string
+	// WrapKey encrypts the data key with the master key keyID.
+	WrapKey(keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key that was wrapped with the master key keyID.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyProvider is a KeyEncryptionKeyProvider holding its master keys in memory, it's meant for development.
+// Data keys are wrapped with AES-256-GCM, authenticated together with the ID of the master key.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewLocalKeyProvider creates a LocalKeyProvider from master keys by ID, current is the ID new data keys are wrapped with.
+func NewLocalKeyProvider(current string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current master key %q: %w", current, ErrUnknownMasterKey)
+	}
+
+	p := &LocalKeyProvider{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("invalid master key ID %q", id)
+		}
+		if len(key) != MasterKeySize {
+			return nil, fmt.Errorf("master key %q: %w", id, ErrInvalidMasterKey)
+		}
+
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		p.keys[id] = aead
+	}
+
+	return p, nil
+}
+
+// keyFile is the document read by NewFileKeyProvider.
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// NewFileKeyProvider reads the master keys from a JSON file of base64 encoded keys by ID:
+//
+//	{"current": "2024-06", "keys": {"2024-01": "...", "2024-06": "..."}}
+func NewFileKeyProvider(path string) (*LocalKeyProvider, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyFile
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("master key file %s: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, errDecode := base64.StdEncoding.DecodeString(encoded)
+		if errDecode != nil {
+			return nil, fmt.Errorf("master key %q: %w", id, errDecode)
+		}
+		keys[id] = key
+	}
+
+	return NewLocalKeyProvider(file.Current, keys)
+}
+
+// NewEnvKeyProvider parses master keys given as comma separated "id:base64" pairs, e.g. the value of an
+// environment variable. current selects the key new data keys are wrapped with, the last key if it's empty.
+func NewEnvKeyProvider(spec, current string) (*LocalKeyProvider, error) {
+	var last string
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("master key %q isn't an id:base64 pair", parts[0])
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("master key %q: %w", parts[0], err)
+		}
+		keys[parts[0]] = key
+		last = parts[0]
+	}
+
+	if current == "" {
+		current = last
+	}
+
+	return NewLocalKeyProvider(current, keys)
+}
+
+// CurrentKeyID implements KeyEncryptionKeyProvider.
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+// WrapKey implements KeyEncryptionKeyProvider.
+func (p *LocalKeyProvider) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMasterKey, keyID)
+	}
+
+	return seal(aead, dataKey, []byte(keyID))
+}
+
+// UnwrapKey implements KeyEncryptionKeyProvider.
+func (p *LocalKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMasterKey, keyID)
+	}
+
+	return open(aead, wrapped, []byte(keyID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidSealedKey
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrInvalidSealedKey
+	}
+
+	return plaintext, nil
+}
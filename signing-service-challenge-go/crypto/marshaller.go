@@ -3,4 +3,6 @@ package crypto
 type KeyPairMarshaller interface {
 	Marshal(keyPair interface{}) (public []byte, private []byte, err error)
 	UnMarshal(privateKeyBytes []byte) (keyPair interface{}, err error)
+	// UnMarshalPublic assembles a key pair that only holds the public key from an encoded public key.
+	UnMarshalPublic(publicKeyBytes []byte) (keyPair interface{}, err error)
 }
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+var (
+	ErrPKCS11Unavailable = errors.New("PKCS#11 support isn't compiled in, build with cgo")
+	ErrPKCS11KeyNotFound = errors.New("key not found on the PKCS#11 token")
+	ErrPKCS11WrongToken  = errors.New("key belongs to another PKCS#11 token")
+	ErrPKCS11Closed      = errors.New("PKCS#11 token is closed")
+)
+
+// DefaultPKCS11Sessions is the number of sessions a PKCS11Token opens if PKCS11Config.Sessions isn't set.
+const DefaultPKCS11Sessions = 8
+
+// PKCS11Config selects the token of a PKCS#11 module, e.g. /usr/lib/softhsm/libsofthsm2.so.
+type PKCS11Config struct {
+	Module     string
+	TokenLabel string
+	PIN        string
+	// Sessions is the number of concurrent operations on the token.
+	Sessions int
+}
+
+// PKCS11KeyRef references a key pair on a token. It is stored in place of the private key of a device,
+// the key itself never leaves the token.
+type PKCS11KeyRef struct {
+	Token string `json:"token"`
+	Label string `json:"label"`
+	ID    []byte `json:"id"`
+}
+
+// ParsePKCS11KeyRef parses the stored reference of a device key.
+func ParsePKCS11KeyRef(b []byte) (PKCS11KeyRef, error) {
+	var ref PKCS11KeyRef
+	if err := json.Unmarshal(b, &ref); err != nil || len(ref.ID) == 0 {
+		return PKCS11KeyRef{}, ErrPKCS11KeyNotFound
+	}
+
+	return ref, nil
+}
+
+// Marshal encodes the reference to be stored in place of the private key.
+func (r PKCS11KeyRef) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// curveOIDs are the named curves of CKA_EC_PARAMS.
+var curveOIDs = map[domain.Curve]asn1.ObjectIdentifier{
+	domain.CurveP256: {1, 2, 840, 10045, 3, 1, 7},
+	domain.CurveP384: {1, 3, 132, 0, 34},
+	domain.CurveP521: {1, 3, 132, 0, 35},
+}
+
+var curves = map[domain.Curve]elliptic.Curve{
+	domain.CurveP256: elliptic.P256(),
+	domain.CurveP384: elliptic.P384(),
+	domain.CurveP521: elliptic.P521(),
+}
+
+// parseECPoint decodes CKA_EC_POINT, a DER OCTET STRING holding the uncompressed point.
+// Some modules return the bare point, which is accepted as well.
+func parseECPoint(curve elliptic.Curve, b []byte) (*ecdsa.PublicKey, error) {
+	var point []byte
+	if rest, err := asn1.Unmarshal(b, &point); err != nil || len(rest) != 0 {
+		point = b
+	}
+
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, errors.New("invalid EC point")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// encodePublicKey encodes a public key like the marshaller of the algorithm does.
+func encodePublicKey(key interface{}) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(k)}), nil
+	case *ecdsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC_KEY", Bytes: der}), nil
+	default:
+		return nil, ErrWrongKeyPairType
+	}
+}
+
+// p1363ToDER converts the r||s signature CKM_ECDSA returns to ASN.1 DER.
+func p1363ToDER(signature []byte) ([]byte, error) {
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, errors.New("invalid ECDSA signature")
+	}
+
+	size := len(signature) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+}
@@ -0,0 +1,36 @@
+//go:build !cgo
+// +build !cgo
+
+package crypto
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// PKCS11Token is unavailable without cgo, OpenPKCS11Token returns ErrPKCS11Unavailable.
+type PKCS11Token struct{}
+
+// OpenPKCS11Token returns ErrPKCS11Unavailable, the PKCS#11 module is loaded through cgo.
+func OpenPKCS11Token(PKCS11Config) (*PKCS11Token, error) {
+	return nil, ErrPKCS11Unavailable
+}
+
+// Close implements io.Closer.
+func (t *PKCS11Token) Close() error {
+	return ErrPKCS11Unavailable
+}
+
+// KeyPair implements KeyPairSource.
+func (t *PKCS11Token) KeyPair(domain.Device) (public, private []byte, err error) {
+	return nil, nil, ErrPKCS11Unavailable
+}
+
+// Signer returns ErrPKCS11Unavailable.
+func (t *PKCS11Token) Signer(domain.Device, []byte, Config) (Signer, error) {
+	return nil, ErrPKCS11Unavailable
+}
+
+// DestroyKey implements KeyDestroyer.
+func (t *PKCS11Token) DestroyKey([]byte) error {
+	return ErrPKCS11Unavailable
+}
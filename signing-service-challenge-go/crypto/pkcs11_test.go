@@ -0,0 +1,272 @@
+//go:build cgo
+// +build cgo
+
+package crypto_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/miekg/pkcs11"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// softHSMModules are the usual install locations of SoftHSMv2, SOFTHSM2_MODULE takes precedence.
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+const (
+	tokenLabel = "signing-service"
+	tokenPIN   = "1234"
+)
+
+func TestPKCS11Token(t *testing.T) {
+	token := openSoftHSM(t)
+
+	tests := []struct {
+		device domain.Device
+		config crypto.Config
+	}{
+		{domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP256}, crypto.Config{}},
+		{domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP384, Encoding: domain.EncodingP1363},
+			crypto.Config{ECDSAEncoding: crypto.ECDSAEncodingP1363}},
+		{domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 2048}, crypto.Config{}},
+		{domain.Device{Algorithm: domain.RSAPSSSHA256, KeySize: 2048}, crypto.Config{RSAScheme: crypto.RSAPSS}},
+	}
+
+	for _, tt := range tests {
+		device := tt.device
+		device.ID = uuid.New()
+
+		public, ref, err := token.KeyPair(device)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyRef, err := crypto.ParsePKCS11KeyRef(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyRef.Label != device.ID.String() || keyRef.Token != tokenLabel {
+			t.Fatalf("unexpected key reference %+v", keyRef)
+		}
+
+		signer, err := token.Signer(device, ref, tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := signer.Sign([]byte("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		publicKey, err := crypto.ParsePublicKey(device, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := crypto.NewPublicKeyVerifier(publicKey, tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = verifier.Verify([]byte("data"), signature); err != nil {
+			t.Fatalf("%v: %v", device.Algorithm, err)
+		}
+	}
+
+	_, _, err := token.KeyPair(domain.Device{ID: uuid.New(), Algorithm: domain.Ed25519})
+	if !errors.Is(err, domain.ErrKeyStorageAlgorithm) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyStorageAlgorithm, err)
+	}
+
+	missing, err := crypto.PKCS11KeyRef{Token: tokenLabel, Label: "missing", ID: []byte("missing")}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = token.Signer(domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP256}, missing, crypto.Config{})
+	if !errors.Is(err, crypto.ErrPKCS11KeyNotFound) {
+		t.Fatalf("expected %v, got %v", crypto.ErrPKCS11KeyNotFound, err)
+	}
+
+	// a destroyed key is gone from the token
+	device := domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, Curve: domain.CurveP256}
+	_, ref, err := token.KeyPair(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = token.Signer(device, ref, crypto.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = token.DestroyKey(ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = token.Signer(device, ref, crypto.Config{}); !errors.Is(err, crypto.ErrPKCS11KeyNotFound) {
+		t.Fatalf("expected %v after DestroyKey, got %v", crypto.ErrPKCS11KeyNotFound, err)
+	}
+}
+
+func TestPKCS11Token_Close(t *testing.T) {
+	token := openSoftHSM(t)
+
+	device := domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, Curve: domain.CurveP256}
+	_, ref, err := token.KeyPair(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := token.Signer(device, ref, crypto.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signatures running while the token closes either complete or fail, the sessions are closed afterwards
+	var wg sync.WaitGroup
+	for n := 0; n < 4*crypto.DefaultPKCS11Sessions; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				if _, errSign := signer.Sign([]byte("data")); errSign != nil {
+					if !errors.Is(errSign, crypto.ErrPKCS11Closed) {
+						t.Error(errSign)
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	if err = token.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if _, err = signer.Sign([]byte("data")); !errors.Is(err, crypto.ErrPKCS11Closed) {
+		t.Fatalf("expected %v, got %v", crypto.ErrPKCS11Closed, err)
+	}
+	if _, _, err = token.KeyPair(device); !errors.Is(err, crypto.ErrPKCS11Closed) {
+		t.Fatalf("expected %v, got %v", crypto.ErrPKCS11Closed, err)
+	}
+}
+
+// openSoftHSM initializes a token in a temporary SoftHSMv2 store. The test is skipped without SoftHSMv2,
+// unless PKCS11_TEST_REQUIRED is set, see the test-pkcs11 target of the Makefile.
+func openSoftHSM(t *testing.T) *crypto.PKCS11Token {
+	t.Helper()
+
+	module := findSoftHSM()
+	if module == "" {
+		if os.Getenv("PKCS11_TEST_REQUIRED") != "" {
+			t.Fatal("SoftHSMv2 isn't installed, set SOFTHSM2_MODULE to its library")
+		}
+		t.Skip("SoftHSMv2 isn't installed, set SOFTHSM2_MODULE to its library")
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokens)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Setenv("SOFTHSM2_CONF", conf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Unsetenv("SOFTHSM2_CONF") //nolint:errcheck
+	})
+
+	initToken(t, module)
+
+	token, err := crypto.OpenPKCS11Token(crypto.PKCS11Config{Module: module, TokenLabel: tokenLabel, PIN: tokenPIN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		token.Close() //nolint:errcheck
+	})
+
+	return token
+}
+
+func findSoftHSM() string {
+	if module := os.Getenv("SOFTHSM2_MODULE"); module != "" {
+		return module
+	}
+
+	for _, module := range softHSMModules {
+		if _, err := os.Stat(module); err == nil {
+			return module
+		}
+	}
+
+	return ""
+}
+
+// initToken initializes the first slot of the module like softhsm2-util --init-token.
+func initToken(t *testing.T, module string) {
+	t.Helper()
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		t.Fatalf("could not load %s", module)
+	}
+	defer ctx.Destroy()
+
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize() //nolint:errcheck
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no slot: %v", err)
+	}
+	if err = ctx.InitToken(slots[0], tokenPIN, tokenLabel); err != nil {
+		t.Fatal(err)
+	}
+
+	// the initialized token moves to a new slot
+	slots, err = ctx.GetSlotList(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, slot := range slots {
+		info, errInfo := ctx.GetTokenInfo(slot)
+		if errInfo != nil || info.Label != tokenLabel {
+			continue
+		}
+
+		session, errSession := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if errSession != nil {
+			t.Fatal(errSession)
+		}
+		defer ctx.CloseSession(session) //nolint:errcheck
+
+		if err = ctx.Login(session, pkcs11.CKU_SO, tokenPIN); err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Logout(session) //nolint:errcheck
+
+		if err = ctx.InitPIN(session, tokenPIN); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	t.Fatalf("token %s not found after initialization", tokenLabel)
+}
@@ -0,0 +1,441 @@
+//go:build cgo
+// +build cgo
+
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// pkcs11KeyIDSize is the length of the random CKA_ID of generated key pairs.
+const pkcs11KeyIDSize = 16
+
+// PKCS11Token generates and uses device keys on a PKCS#11 token, e.g. an HSM or SoftHSMv2.
+// Private keys are created sensitive and not extractable, signatures are computed by the token.
+// It is safe for concurrent use, operations are spread over a pool of logged in sessions.
+type PKCS11Token struct {
+	ctx      *pkcs11.Ctx
+	label    string
+	sessions chan pkcs11.SessionHandle
+
+	// closeMu guards closed, sessions are only taken from the pool while the token is open.
+	closeMu sync.RWMutex
+	closed  bool
+	// inUse counts the sessions taken from the pool, Close waits until they are released.
+	inUse sync.WaitGroup
+
+	handlesMu sync.RWMutex
+	handles   map[string]pkcs11.ObjectHandle
+}
+
+// OpenPKCS11Token loads the module, opens the sessions on the token with the label and logs them in with the PIN.
+func OpenPKCS11Token(config PKCS11Config) (*PKCS11Token, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("could not load PKCS#11 module %s", config.Module)
+	}
+
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("initialize PKCS#11 module: %w", err)
+	}
+
+	slot, err := findSlot(ctx, config.TokenLabel)
+	if err != nil {
+		ctx.Finalize() //nolint:errcheck
+		ctx.Destroy()
+		return nil, err
+	}
+
+	size := config.Sessions
+	if size <= 0 {
+		size = DefaultPKCS11Sessions
+	}
+
+	token := &PKCS11Token{
+		ctx:      ctx,
+		label:    config.TokenLabel,
+		sessions: make(chan pkcs11.SessionHandle, size),
+		handles:  make(map[string]pkcs11.ObjectHandle),
+	}
+	for i := 0; i < size; i++ {
+		session, errSession := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if errSession != nil {
+			token.Close() //nolint:errcheck
+			return nil, fmt.Errorf("open PKCS#11 session: %w", errSession)
+		}
+		token.sessions <- session
+
+		// the login state is shared by all sessions of the application
+		if i == 0 {
+			errLogin := ctx.Login(session, pkcs11.CKU_USER, config.PIN)
+			if errLogin != nil && !isPKCS11Error(errLogin, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+				token.Close() //nolint:errcheck
+				return nil, fmt.Errorf("PKCS#11 login: %w", errLogin)
+			}
+		}
+	}
+
+	return token, nil
+}
+
+func findSlot(ctx *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("list PKCS#11 slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		info, errInfo := ctx.GetTokenInfo(slot)
+		if errInfo != nil {
+			return 0, fmt.Errorf("PKCS#11 token info: %w", errInfo)
+		}
+		if info.Label == label {
+			return slot, nil
+		}
+	}
+
+	return 0, fmt.Errorf("PKCS#11 token %q not found", label)
+}
+
+// Close logs out and closes the sessions of the token once the running operations released them.
+// Operations started afterwards fail with ErrPKCS11Closed.
+func (t *PKCS11Token) Close() error {
+	t.closeMu.Lock()
+	if t.closed {
+		t.closeMu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.closeMu.Unlock()
+
+	t.inUse.Wait()
+	close(t.sessions)
+	first := true
+	for session := range t.sessions {
+		if first {
+			t.ctx.Logout(session) //nolint:errcheck
+			first = false
+		}
+		t.ctx.CloseSession(session) //nolint:errcheck
+	}
+
+	err := t.ctx.Finalize()
+	t.ctx.Destroy()
+
+	return err
+}
+
+// KeyPair generates the key pair of the device on the token. It returns the PEM encoded public key and
+// the reference to the private key, which is stored in its place. It implements KeyPairSource.
+func (t *PKCS11Token) KeyPair(device domain.Device) (public, private []byte, err error) {
+	ref := PKCS11KeyRef{Token: t.label, Label: device.ID.String(), ID: make([]byte, pkcs11KeyIDSize)}
+	if _, err = rand.Read(ref.ID); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		mechanism []*pkcs11.Mechanism
+		publicKey = []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, ref.Label),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, ref.ID),
+		}
+	)
+	switch device.Algorithm {
+	case domain.ECDSA:
+		oid, ok := curveOIDs[device.Curve]
+		if !ok {
+			return nil, nil, fmt.Errorf("curve %q: %w", device.Curve, domain.ErrKeyStorageAlgorithm)
+		}
+		params, errParams := asn1.Marshal(oid)
+		if errParams != nil {
+			return nil, nil, errParams
+		}
+		mechanism = []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)}
+		publicKey = append(publicKey, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params))
+	case domain.RSAPKCS1SHA256, domain.RSAPSSSHA256:
+		mechanism = []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)}
+		publicKey = append(publicKey,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, device.KeySize),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, big.NewInt(65537).Bytes()),
+		)
+	default:
+		return nil, nil, domain.ErrKeyStorageAlgorithm
+	}
+
+	privateKey := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, ref.Label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, ref.ID),
+	}
+
+	session, err := t.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.release(session)
+
+	publicHandle, privateHandle, err := t.ctx.GenerateKeyPair(session, mechanism, publicKey, privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key pair on PKCS#11 token: %w", err)
+	}
+
+	key, err := t.publicKey(session, device, publicHandle)
+	if err != nil {
+		return nil, nil, err
+	}
+	if public, err = encodePublicKey(key); err != nil {
+		return nil, nil, err
+	}
+	if private, err = ref.Marshal(); err != nil {
+		return nil, nil, err
+	}
+
+	t.handlesMu.Lock()
+	t.handles[string(ref.ID)] = privateHandle
+	t.handlesMu.Unlock()
+
+	return public, private, nil
+}
+
+// DestroyKey deletes the key pair of the reference KeyPair returned from the token. It implements KeyDestroyer.
+func (t *PKCS11Token) DestroyKey(ref []byte) error {
+	keyRef, err := ParsePKCS11KeyRef(ref)
+	if err != nil {
+		return err
+	}
+	if keyRef.Token != t.label {
+		return fmt.Errorf("%w %q", ErrPKCS11WrongToken, keyRef.Token)
+	}
+
+	session, err := t.acquire()
+	if err != nil {
+		return err
+	}
+	defer t.release(session)
+
+	// the public and the private key share the CKA_ID
+	err = t.ctx.FindObjectsInit(session, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_ID, keyRef.ID)})
+	if err != nil {
+		return fmt.Errorf("find PKCS#11 key: %w", err)
+	}
+	handles, _, err := t.ctx.FindObjects(session, 2)
+	if errFinal := t.ctx.FindObjectsFinal(session); err == nil {
+		err = errFinal
+	}
+	if err != nil {
+		return fmt.Errorf("find PKCS#11 key: %w", err)
+	}
+
+	t.forgetKey(keyRef)
+	for _, handle := range handles {
+		if err = t.ctx.DestroyObject(session, handle); err != nil {
+			return fmt.Errorf("destroy PKCS#11 key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *PKCS11Token) publicKey(session pkcs11.SessionHandle, device domain.Device, handle pkcs11.ObjectHandle) (interface{}, error) {
+	if device.Algorithm == domain.ECDSA {
+		attributes, err := t.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read EC point: %w", err)
+		}
+
+		return parseECPoint(curves[device.Curve], attributes[0].Value)
+	}
+
+	attributes, err := t.ctx.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read RSA public key: %w", err)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attributes[0].Value),
+		E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+	}, nil
+}
+
+// Signer returns the Signer of a device key, ref is the reference KeyPair stored in place of the private key.
+func (t *PKCS11Token) Signer(device domain.Device, ref []byte, config Config) (Signer, error) {
+	keyRef, err := ParsePKCS11KeyRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if keyRef.Token != t.label {
+		return nil, fmt.Errorf("%w %q", ErrPKCS11WrongToken, keyRef.Token)
+	}
+
+	signer := &pkcs11Signer{token: t, ref: keyRef}
+	switch device.Algorithm {
+	case domain.ECDSA:
+		curve, ok := curves[device.Curve]
+		if !ok {
+			return nil, domain.ErrKeyStorageAlgorithm
+		}
+		signer.mechanism = []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}
+		signer.hash = CurveHash(curve)
+		signer.der = config.ECDSAEncoding != ECDSAEncodingP1363
+	case domain.RSAPKCS1SHA256, domain.RSAPSSSHA256:
+		if config.RSAScheme == RSAPSS {
+			params := pkcs11.NewPSSParams(pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, 32)
+			signer.mechanism = []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_SHA256_RSA_PKCS_PSS, params)}
+		} else {
+			signer.mechanism = []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_SHA256_RSA_PKCS, nil)}
+		}
+	default:
+		return nil, domain.ErrKeyStorageAlgorithm
+	}
+
+	// fail early if the key isn't on the token
+	session, err := t.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer t.release(session)
+	if _, err = t.findKey(session, keyRef); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+// findKey returns the handle of the private key, handles are cached until the token invalidates them.
+func (t *PKCS11Token) findKey(session pkcs11.SessionHandle, ref PKCS11KeyRef) (pkcs11.ObjectHandle, error) {
+	t.handlesMu.RLock()
+	handle, ok := t.handles[string(ref.ID)]
+	t.handlesMu.RUnlock()
+	if ok {
+		return handle, nil
+	}
+
+	err := t.ctx.FindObjectsInit(session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, ref.ID),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("find PKCS#11 key: %w", err)
+	}
+	handles, _, err := t.ctx.FindObjects(session, 1)
+	if errFinal := t.ctx.FindObjectsFinal(session); err == nil {
+		err = errFinal
+	}
+	if err != nil {
+		return 0, fmt.Errorf("find PKCS#11 key: %w", err)
+	}
+	if len(handles) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrPKCS11KeyNotFound, ref.Label)
+	}
+
+	t.handlesMu.Lock()
+	t.handles[string(ref.ID)] = handles[0]
+	t.handlesMu.Unlock()
+
+	return handles[0], nil
+}
+
+func (t *PKCS11Token) forgetKey(ref PKCS11KeyRef) {
+	t.handlesMu.Lock()
+	delete(t.handles, string(ref.ID))
+	t.handlesMu.Unlock()
+}
+
+// acquire takes a session from the pool, waiting for one to be released if all are in use.
+func (t *PKCS11Token) acquire() (pkcs11.SessionHandle, error) {
+	t.closeMu.RLock()
+	defer t.closeMu.RUnlock()
+
+	if t.closed {
+		return 0, ErrPKCS11Closed
+	}
+	t.inUse.Add(1)
+
+	return <-t.sessions, nil
+}
+
+func (t *PKCS11Token) release(session pkcs11.SessionHandle) {
+	t.sessions <- session
+	t.inUse.Done()
+}
+
+type pkcs11Signer struct {
+	token     *PKCS11Token
+	ref       PKCS11KeyRef
+	mechanism []*pkcs11.Mechanism
+
+	// hash is the digest computed before CKM_ECDSA, which signs a digest. RSA mechanisms hash themselves.
+	hash gocrypto.Hash
+	der  bool
+}
+
+// Sign signs dataToBeSigned on the token. A key handle the token no longer knows, e.g. after it was
+// reconnected, is looked up again once.
+func (s *pkcs11Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	session, err := s.token.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer s.token.release(session)
+
+	data := dataToBeSigned
+	if s.hash != 0 {
+		data = sum(s.hash, dataToBeSigned)
+	}
+
+	signature, err := s.sign(session, data)
+	if isPKCS11Error(err, pkcs11.CKR_OBJECT_HANDLE_INVALID) || isPKCS11Error(err, pkcs11.CKR_KEY_HANDLE_INVALID) {
+		s.token.forgetKey(s.ref)
+		signature, err = s.sign(session, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.der {
+		return p1363ToDER(signature)
+	}
+
+	return signature, nil
+}
+
+func (s *pkcs11Signer) sign(session pkcs11.SessionHandle, data []byte) ([]byte, error) {
+	handle, err := s.token.findKey(session, s.ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.token.ctx.SignInit(session, s.mechanism, handle); err != nil {
+		return nil, err
+	}
+
+	return s.token.ctx.Sign(session, data)
+}
+
+func isPKCS11Error(err error, code uint) bool {
+	var pkcs11Err pkcs11.Error
+	return errors.As(err, &pkcs11Err) && uint(pkcs11Err) == code
+}
@@ -0,0 +1,351 @@
+package crypto
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// KeyPairSource provides the PEM encoded key pair of a new device.
+type KeyPairSource interface {
+	KeyPair(device domain.Device) (public, private []byte, err error)
+}
+
+// KeyDestroyer is implemented by key pair sources that keep the generated keys, e.g. a PKCS#11 token.
+// DestroyKey deletes a key pair that was generated but never stored with a device.
+type KeyDestroyer interface {
+	DestroyKey(private []byte) error
+}
+
+// KeyPairSourceFunc adapts a function like GetKeyPair to a KeyPairSource.
+type KeyPairSourceFunc func(device domain.Device) (public, private []byte, err error)
+
+// KeyPair calls f(device).
+func (f KeyPairSourceFunc) KeyPair(device domain.Device) (public, private []byte, err error) {
+	return f(device)
+}
+
+// KeyPoolConfig configures the pool of one algorithm/parameter combination.
+type KeyPoolConfig struct {
+	Algorithm domain.Algorithm
+	Curve     domain.Curve
+	KeySize   int
+
+	// Depth is the number of key pairs the pool keeps ready.
+	Depth int
+	// Workers is the number of goroutines refilling the pool, 1 if zero.
+	Workers int
+}
+
+// Name identifies the combination of the config, e.g. RSA_4096 or ECDSA_P256.
+func (c KeyPoolConfig) Name() string {
+	switch c.key().Algorithm {
+	case domain.RSAPKCS1SHA256:
+		return fmt.Sprintf("RSA_%d", c.KeySize)
+	case domain.ECDSA:
+		return "ECDSA_" + strings.ReplaceAll(string(c.Curve), "-", "")
+	case domain.Ed25519:
+		return "ED25519"
+	default:
+		return fmt.Sprintf("ALGORITHM_%d", c.Algorithm)
+	}
+}
+
+// key returns the identity of the pool. RSA schemes share their key material, so they share a pool.
+func (c KeyPoolConfig) key() poolKey {
+	algorithm := c.Algorithm
+	if algorithm == domain.RSAPSSSHA256 {
+		algorithm = domain.RSAPKCS1SHA256
+	}
+
+	return poolKey{Algorithm: algorithm, Curve: c.Curve, KeySize: c.KeySize}
+}
+
+// PoolConfigs returns a config with the given depth for every combination allowed by the policy.
+func PoolConfigs(policy domain.KeyPolicy, depth int) []KeyPoolConfig {
+	configs := make([]KeyPoolConfig, 0, len(policy.RSAKeySizes)+len(policy.Curves)+1)
+	for _, size := range policy.RSAKeySizes {
+		configs = append(configs, KeyPoolConfig{Algorithm: domain.RSAPKCS1SHA256, KeySize: size, Depth: depth})
+	}
+	for _, curve := range policy.Curves {
+		configs = append(configs, KeyPoolConfig{Algorithm: domain.ECDSA, Curve: curve, Depth: depth})
+	}
+
+	return append(configs, KeyPoolConfig{Algorithm: domain.Ed25519, Depth: depth})
+}
+
+type poolKey struct {
+	Algorithm domain.Algorithm
+	Curve     domain.Curve
+	KeySize   int
+}
+
+// RefillBuckets are the upper bounds of the generation time histogram of the pools.
+// ECDSA and Ed25519 keys fall into the first buckets, RSA keys take up to seconds.
+var RefillBuckets = [...]time.Duration{
+	time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+type pemKeyPair struct {
+	public, private []byte
+}
+
+type pool struct {
+	config KeyPoolConfig
+	keys   chan pemKeyPair
+
+	generated   uint64
+	taken       uint64
+	misses      uint64
+	failures    uint64
+	refillNanos uint64
+	lastRefill  int64
+	// refills counts the generated key pairs per bucket of RefillBuckets, the last one counts the slower ones
+	refills [len(RefillBuckets) + 1]uint64
+}
+
+// KeyPoolStats is a snapshot of the state of one pool.
+type KeyPoolStats struct {
+	Name        string
+	Depth       int
+	TargetDepth int
+	Generated   uint64
+	Taken       uint64
+	Misses      uint64
+	Failures    uint64
+	// RefillTotal is the time spent generating the Generated key pairs.
+	RefillTotal time.Duration
+	// LastRefill is the generation time of the latest key pair.
+	LastRefill time.Duration
+	// RefillBuckets is the cumulative number of key pairs generated within each upper bound of RefillBuckets,
+	// followed by the number of all of them. It is read separately from Generated and may be ahead of it.
+	RefillBuckets []uint64
+}
+
+// KeyPool keeps pre-generated key pairs ready for the creation of devices.
+// Background workers refill every pool to its target depth.
+// A key pair is taken out of its pool by exactly one caller, so it is never handed out twice.
+// Pooled private keys are held in plaintext in memory until they are taken out and sealed by the caller,
+// see SealPrivateKey. The pool depth bounds how many of them are exposed to a memory dump at a time.
+type KeyPool struct {
+	pools    map[poolKey]*pool
+	generate KeyPairSourceFunc
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// NewKeyPool creates a KeyPool, Start has to be called to fill it.
+func NewKeyPool(configs []KeyPoolConfig) *KeyPool {
+	p := &KeyPool{
+		pools:    make(map[poolKey]*pool, len(configs)),
+		generate: GetKeyPair,
+		stop:     make(chan struct{}),
+	}
+
+	for _, config := range configs {
+		if config.Depth <= 0 {
+			continue
+		}
+		p.pools[config.key()] = &pool{
+			config: config,
+			keys:   make(chan pemKeyPair, config.Depth),
+		}
+	}
+
+	return p
+}
+
+// Start starts the refill workers of all pools.
+func (p *KeyPool) Start() {
+	for _, pl := range p.pools {
+		workers := pl.config.Workers
+		if workers <= 0 {
+			workers = 1
+		}
+
+		for n := 0; n < workers; n++ {
+			p.wg.Add(1)
+			go p.refill(pl)
+		}
+	}
+}
+
+// Stop stops the refill workers and waits for them to return.
+func (p *KeyPool) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+}
+
+// KeyPair takes a ready key pair for the device out of its pool.
+// When there is no pool for the parameters of the device or the pool is empty,
+// the key pair is generated synchronously.
+func (p *KeyPool) KeyPair(device domain.Device) (public, private []byte, err error) {
+	config := KeyPoolConfig{Algorithm: device.Algorithm, Curve: device.Curve, KeySize: device.KeySize}
+
+	pl, ok := p.pools[config.key()]
+	if !ok {
+		return p.generate(device)
+	}
+
+	select {
+	case k := <-pl.keys:
+		atomic.AddUint64(&pl.taken, 1)
+
+		return k.public, k.private, nil
+	default:
+		atomic.AddUint64(&pl.misses, 1)
+
+		return p.generate(device)
+	}
+}
+
+// Stats returns a snapshot of every pool.
+func (p *KeyPool) Stats() []KeyPoolStats {
+	stats := make([]KeyPoolStats, 0, len(p.pools))
+	for _, pl := range p.pools {
+		stats = append(stats, KeyPoolStats{
+			Name:        pl.config.Name(),
+			Depth:       len(pl.keys),
+			TargetDepth: pl.config.Depth,
+			Generated:   atomic.LoadUint64(&pl.generated),
+			Taken:       atomic.LoadUint64(&pl.taken),
+			Misses:      atomic.LoadUint64(&pl.misses),
+			Failures:    atomic.LoadUint64(&pl.failures),
+			RefillTotal: time.Duration(atomic.LoadUint64(&pl.refillNanos)),
+			LastRefill:  time.Duration(atomic.LoadInt64(&pl.lastRefill)),
+
+			RefillBuckets: pl.refillBuckets(),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	return stats
+}
+
+// WriteMetrics writes the pool stats in the Prometheus text exposition format.
+func (p *KeyPool) WriteMetrics(w io.Writer) error {
+	stats := p.Stats()
+
+	metrics := []struct {
+		name, help, kind string
+		value            func(s KeyPoolStats) float64
+	}{
+		{"keypool_depth", "Number of ready key pairs.", "gauge",
+			func(s KeyPoolStats) float64 { return float64(s.Depth) }},
+		{"keypool_target_depth", "Configured number of ready key pairs.", "gauge",
+			func(s KeyPoolStats) float64 { return float64(s.TargetDepth) }},
+		{"keypool_taken_total", "Key pairs taken from the pool.", "counter",
+			func(s KeyPoolStats) float64 { return float64(s.Taken) }},
+		{"keypool_misses_total", "Key pairs generated synchronously because the pool was empty.", "counter",
+			func(s KeyPoolStats) float64 { return float64(s.Misses) }},
+		{"keypool_refill_failures_total", "Failed key pair generations of the refill workers.", "counter",
+			func(s KeyPoolStats) float64 { return float64(s.Failures) }},
+		{"keypool_refill_last_seconds", "Generation time of the latest key pair.", "gauge",
+			func(s KeyPoolStats) float64 { return s.LastRefill.Seconds() }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return err
+		}
+		for _, s := range stats {
+			if _, err := fmt.Fprintf(w, "%s{pool=%q} %g\n", m.name, s.Name, m.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeRefillHistogram(w, stats)
+}
+
+// writeRefillHistogram writes the generation times of the pools as one histogram.
+func writeRefillHistogram(w io.Writer, stats []KeyPoolStats) error {
+	const name = "keypool_refill_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s Generation time of the key pairs for the pool.\n# TYPE %s histogram\n", name, name); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		for i, bound := range RefillBuckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket{pool=%q,le=\"%g\"} %d\n", name, s.Name, bound.Seconds(), s.RefillBuckets[i]); err != nil {
+				return err
+			}
+		}
+		// the count is taken from the buckets, Generated is read separately and may lag behind them
+		count := s.RefillBuckets[len(RefillBuckets)]
+		if _, err := fmt.Fprintf(w, "%s_bucket{pool=%q,le=\"+Inf\"} %d\n%s_sum{pool=%q} %g\n%s_count{pool=%q} %d\n",
+			name, s.Name, count, name, s.Name, s.RefillTotal.Seconds(), name, s.Name, count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refillBuckets returns the cumulative bucket counts of the refill histogram.
+func (pl *pool) refillBuckets() []uint64 {
+	buckets := make([]uint64, len(pl.refills))
+	var total uint64
+	for i := range buckets {
+		total += atomic.LoadUint64(&pl.refills[i])
+		buckets[i] = total
+	}
+
+	return buckets
+}
+
+// observeRefill records the generation time of a key pair.
+func (pl *pool) observeRefill(elapsed time.Duration) {
+	bucket := sort.Search(len(RefillBuckets), func(i int) bool { return elapsed <= RefillBuckets[i] })
+	atomic.AddUint64(&pl.refills[bucket], 1)
+	atomic.AddUint64(&pl.refillNanos, uint64(elapsed))
+	atomic.StoreInt64(&pl.lastRefill, int64(elapsed))
+	atomic.AddUint64(&pl.generated, 1)
+}
+
+func (p *KeyPool) refill(pl *pool) {
+	defer p.wg.Done()
+
+	device := domain.Device{Algorithm: pl.config.Algorithm, Curve: pl.config.Curve, KeySize: pl.config.KeySize}
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		start := time.Now()
+		public, private, err := p.generate(device)
+		if err != nil {
+			atomic.AddUint64(&pl.failures, 1)
+			// avoid a hot loop on persistent errors
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(time.Second):
+			}
+
+			continue
+		}
+
+		pl.observeRefill(time.Since(start))
+
+		select {
+		case pl.keys <- pemKeyPair{public: public, private: private}:
+		case <-p.stop:
+			return
+		}
+	}
+}
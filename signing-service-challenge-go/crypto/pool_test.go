@@ -0,0 +1,86 @@
+package crypto_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestKeyPool_KeyPair(t *testing.T) {
+	t.Parallel()
+
+	const (
+		depth = 8
+		takes = 64
+	)
+
+	pool := crypto.NewKeyPool([]crypto.KeyPoolConfig{{Algorithm: domain.Ed25519, Depth: depth, Workers: 2}})
+	pool.Start()
+	defer pool.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stats()[0].Depth < depth {
+		if time.Now().After(deadline) {
+			t.Fatal("pool wasn't filled in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[string]struct{}, takes)
+	)
+
+	for n := 0; n < takes; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, private, err := pool.KeyPair(domain.Device{Algorithm: domain.Ed25519})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := seen[string(private)]; ok {
+				t.Error("key pair was handed out twice")
+			}
+			seen[string(private)] = struct{}{}
+		}()
+	}
+	wg.Wait()
+
+	stats := pool.Stats()[0]
+	if stats.Name != "ED25519" {
+		t.Fatalf("unexpected pool name %s", stats.Name)
+	}
+	if stats.Taken < depth || stats.Taken+stats.Misses != takes {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	var metrics strings.Builder
+	if err := pool.WriteMetrics(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`keypool_target_depth{pool="ED25519"} 8`,
+		"# TYPE keypool_refill_seconds histogram\n",
+		`keypool_refill_seconds_bucket{pool="ED25519",le="0.001"}`,
+		`keypool_refill_seconds_bucket{pool="ED25519",le="+Inf"}`,
+		`keypool_refill_seconds_count{pool="ED25519"}`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Fatalf("expected %q in metrics\n%s", want, metrics.String())
+		}
+	}
+	if strings.Count(metrics.String(), "# TYPE keypool_refill_seconds") != 1 {
+		t.Fatalf("expected one type of the refill histogram\n%s", metrics.String())
+	}
+}
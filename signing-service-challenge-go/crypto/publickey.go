@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// PublicKey is the public key of a device together with the parameters external verifiers need.
+type PublicKey struct {
+	Algorithm domain.Algorithm
+	Encoding  domain.SignatureEncoding
+	Key       gocrypto.PublicKey
+}
+
+// NewMarshaller returns the KeyPairMarshaller of the keys of an algorithm.
+func NewMarshaller(algorithm domain.Algorithm) (KeyPairMarshaller, error) {
+	switch algorithm {
+	case domain.RSAPKCS1SHA256, domain.RSAPSSSHA256:
+		return NewRSAMarshaller(), nil
+	case domain.ECDSA:
+		return NewECCMarshaller(), nil
+	case domain.Ed25519:
+		return NewEd25519Marshaller(), nil
+	default:
+		return nil, ErrWrongAlgorithmType
+	}
+}
+
+// ParsePublicKey parses the stored public key of a device.
+func ParsePublicKey(device domain.Device, publicKeyBytes []byte) (PublicKey, error) {
+	marshaller, err := NewMarshaller(device.Algorithm)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	keyPair, err := marshaller.UnMarshalPublic(publicKeyBytes)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	publicKey := PublicKey{Algorithm: device.Algorithm, Encoding: device.Encoding}
+	switch k := keyPair.(type) {
+	case *RSAKeyPair:
+		publicKey.Key = k.Public
+	case *ECCKeyPair:
+		publicKey.Key = k.Public
+	case *Ed25519KeyPair:
+		publicKey.Key = k.Public
+	default:
+		return PublicKey{}, ErrWrongKeyPairType
+	}
+
+	return publicKey, nil
+}
+
+// ParsePEMPublicKey parses the PEM encoded PKIX public key of a device, as returned by PublicKey.PEM.
+func ParsePEMPublicKey(device domain.Device, pemBytes []byte) (PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return PublicKey{}, ErrInvalidPEM
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	publicKey := PublicKey{Algorithm: device.Algorithm, Encoding: device.Encoding, Key: key}
+	if _, err = NewPublicKeyVerifier(publicKey, Config{}); err != nil {
+		return PublicKey{}, err
+	}
+
+	return publicKey, nil
+}
+
+// DER returns the key as DER encoded PKIX SubjectPublicKeyInfo.
+func (p PublicKey) DER() ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(p.Key)
+}
+
+// PEM returns the key as PEM encoded PKIX SubjectPublicKeyInfo.
+func (p PublicKey) PEM() ([]byte, error) {
+	der, err := p.DER()
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	}), nil
+}
+
+// Fingerprint returns the hex encoded SHA-256 digest of the DER encoded key.
+func (p PublicKey) Fingerprint() (string, error) {
+	der, err := p.DER()
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(der)
+
+	return hex.EncodeToString(digest[:]), nil
+}
@@ -0,0 +1,66 @@
+package crypto_test
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestPublicKey_JWK(t *testing.T) {
+	t.Parallel()
+
+	keyPair, err := (&crypto.ECCGenerator{Curve: elliptic.P521()}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, _, err := crypto.NewECCMarshaller().Marshal(keyPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// JWS ES512 expects r||s signatures, so only P1363 devices get the alg
+	der, err := crypto.ParsePublicKey(domain.Device{Algorithm: domain.ECDSA}, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := der.JWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk.Kty != "EC" || jwk.Crv != "P-521" || jwk.Alg != "" {
+		t.Fatalf("unexpected JWK of a DER device %+v", jwk)
+	}
+
+	publicKey, err := crypto.ParsePublicKey(domain.Device{Algorithm: domain.ECDSA, Encoding: domain.EncodingP1363}, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk, err = publicKey.JWK(); err != nil {
+		t.Fatal(err)
+	}
+	if jwk.Kty != "EC" || jwk.Crv != "P-521" || jwk.Alg != "ES512" {
+		t.Fatalf("unexpected JWK %+v", jwk)
+	}
+
+	// coordinates are padded to the curve size
+	for _, coordinate := range []string{jwk.X, jwk.Y} {
+		raw, errDecode := base64.RawURLEncoding.DecodeString(coordinate)
+		if errDecode != nil {
+			t.Fatal(errDecode)
+		}
+		if len(raw) != 66 {
+			t.Fatalf("expected 66 bytes, got %d", len(raw))
+		}
+	}
+
+	fingerprint, err := publicKey.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fingerprint) != 64 {
+		t.Fatalf("unexpected fingerprint %s", fingerprint)
+	}
+}
@@ -51,6 +51,23 @@ func (m *RSAMarshaler) UnMarshal(privateKeyBytes []byte) (keyPair interface{}, e
 	}, nil
 }
 
+// UnMarshalPublic assembles an RSAKeyPair without private key from an encoded public key.
+func (m *RSAMarshaler) UnMarshalPublic(publicKeyBytes []byte) (keyPair interface{}, err error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RSAKeyPair{
+		Public: publicKey,
+	}, nil
+}
+
 // NewRSAMarshaller creates a new RSAMarshaler.
 func NewRSAMarshaller() KeyPairMarshaller {
 	return &RSAMarshaler{}
@@ -1,15 +1,37 @@
 package crypto
 
 import (
+	gocrypto "crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"hash"
 	"io"
 )
 
+// RSAScheme defines the RSA signature scheme used by RSASigner.
+type RSAScheme int
+
+const (
+	// RSAPKCS1v15 is RSASSA-PKCS1-v1_5.
+	RSAPKCS1v15 RSAScheme = iota
+	// RSAPSS is RSASSA-PSS with a salt as long as the digest.
+	RSAPSS RSAScheme = iota
+)
+
+// ECDSAEncoding defines how ECCSigner serializes the (r, s) pair of a signature.
+type ECDSAEncoding int
+
+const (
+	// ECDSAEncodingDER is the ASN.1 DER SEQUENCE { r INTEGER, s INTEGER }.
+	ECDSAEncodingDER ECDSAEncoding = iota
+	// ECDSAEncodingP1363 is the IEEE P1363 concatenation r||s, both padded to the curve size.
+	ECDSAEncodingP1363 ECDSAEncoding = iota
+)
+
 // Signer defines a contract for different types of signing implementations.
+// Implementations must be safe for concurrent use, a parsed signer is shared by all signatures of a device.
 type Signer interface {
 	Sign(dataToBeSigned []byte) ([]byte, error)
 }
@@ -18,66 +40,127 @@ type RSASigner struct {
 	keyPair *RSAKeyPair
 
 	reader io.Reader
-	hash   hash.Hash
+	hash   gocrypto.Hash
+	scheme RSAScheme
 }
 
 type ECCSigner struct {
 	keyPair *ECCKeyPair
 
-	reader io.Reader
-	hash   hash.Hash
+	reader   io.Reader
+	hash     gocrypto.Hash
+	encoding ECDSAEncoding
+}
+
+type Ed25519Signer struct {
+	keyPair *Ed25519KeyPair
 }
 
 type Config struct {
 	reader io.Reader
+
+	// RSAScheme is the signature scheme of RSASigner, RSAPKCS1v15 by default.
+	RSAScheme RSAScheme
+	// ECDSAEncoding is the signature encoding of ECCSigner, ECDSAEncodingDER by default.
+	ECDSAEncoding ECDSAEncoding
 }
 
 // NewRSASigner returns new RSA implementation of Signer
 func NewRSASigner(keyPair *RSAKeyPair, config Config) Signer {
-	signer := &RSASigner{keyPair: keyPair}
-	if config.reader == nil {
+	signer := &RSASigner{
+		keyPair: keyPair,
+		reader:  config.reader,
+		hash:    gocrypto.SHA256,
+		scheme:  config.RSAScheme,
+	}
+	if signer.reader == nil {
 		signer.reader = rand.Reader
-		signer.hash = sha256.New()
-
-		return signer
 	}
 
-	signer.reader = config.reader
 	return signer
 }
 
 // NewECCSigner returns new ecdsa implementation of Signer
 func NewECCSigner(keyPair *ECCKeyPair, config Config) Signer {
-	signer := &ECCSigner{keyPair: keyPair}
-	if config.reader == nil {
+	signer := &ECCSigner{
+		keyPair:  keyPair,
+		reader:   config.reader,
+		hash:     CurveHash(keyPair.Private.Curve),
+		encoding: config.ECDSAEncoding,
+	}
+	if signer.reader == nil {
 		signer.reader = rand.Reader
-		signer.hash = sha256.New()
-
-		return signer
 	}
 
-	signer.reader = config.reader
 	return signer
 }
 
+// NewEd25519Signer returns new Ed25519 implementation of Signer
+func NewEd25519Signer(keyPair *Ed25519KeyPair) Signer {
+	return &Ed25519Signer{keyPair: keyPair}
+}
+
+// Sign hashes dataToBeSigned and signs the digest with the private key.
 func (r *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	res, err := rsa.EncryptPKCS1v15(r.reader, r.keyPair.Public, dataToBeSigned)
-	if err != nil {
-		return nil, err
+	digest := sum(r.hash, dataToBeSigned)
+
+	if r.scheme == RSAPSS {
+		return rsa.SignPSS(r.reader, r.keyPair.Private, r.hash, digest, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+		})
 	}
 
-	return res, nil
+	return rsa.SignPKCS1v15(r.reader, r.keyPair.Private, r.hash, digest)
 }
 
+// Sign hashes dataToBeSigned with the hash matching the curve and signs the digest.
 func (signer *ECCSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, signer.keyPair.Private, dataToBeSigned)
+	digest := sum(signer.hash, dataToBeSigned)
+
+	if signer.encoding != ECDSAEncodingP1363 {
+		return ecdsa.SignASN1(signer.reader, signer.keyPair.Private, digest)
+	}
+
+	r, s, err := ecdsa.Sign(signer.reader, signer.keyPair.Private, digest)
 	if err != nil {
 		return nil, err
 	}
 
-	// print the signature
-	signature := r.Bytes()
-	signature = append(signature, s.Bytes()...)
+	size := curveSize(signer.keyPair.Private.Curve)
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
 
 	return signature, nil
 }
+
+// Sign signs dataToBeSigned with PureEdDSA, which hashes the message itself.
+func (e *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return ed25519.Sign(e.keyPair.Private, dataToBeSigned), nil
+}
+
+// CurveHash returns the hash function matching the size of the curve:
+// SHA-256 for P-256, SHA-384 for P-384 and SHA-512 for P-521.
+func CurveHash(curve elliptic.Curve) gocrypto.Hash {
+	switch bitSize := curve.Params().BitSize; {
+	case bitSize <= 256:
+		return gocrypto.SHA256
+	case bitSize <= 384:
+		return gocrypto.SHA384
+	default:
+		return gocrypto.SHA512
+	}
+}
+
+// curveSize returns the byte length of a scalar on the curve.
+func curveSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// sum returns the digest of data. A new hash.Hash is used on every call, so signers stay safe for concurrent use.
+func sum(h gocrypto.Hash, data []byte) []byte {
+	hasher := h.New()
+	hasher.Write(data) //nolint:errcheck
+
+	return hasher.Sum(nil)
+}
@@ -1,12 +1,22 @@
 package crypto_test
 
 import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
 	"errors"
+	"math/big"
+	"sync"
 	"testing"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 )
 
+var src = []byte("My name is Ihor. I'm working on the tech task. My name is Ihor. I'm working on the tech task. . . .")
+
 func TestNewRSASigner(t *testing.T) {
 	t.Parallel()
 
@@ -28,7 +38,6 @@ func TestRSASigner_Sign(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	src := []byte("My name is Ihor. I'm working on the tech task. My name is Ihor. I'm working on the tech task. . . .")
 	data, err := signer.Sign(src)
 	if err != nil {
 		t.Fatal(err)
@@ -38,11 +47,158 @@ func TestRSASigner_Sign(t *testing.T) {
 	}
 }
 
+func TestRSASigner_Sign_Schemes(t *testing.T) {
+	t.Parallel()
+
+	keyPair, err := getRSAKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// longer than the modulus of the key, which must not matter for a signature
+	long := make([]byte, 4096)
+	digest := sha256.Sum256(long)
+
+	pkcs1, err := crypto.NewRSASigner(keyPair, crypto.Config{RSAScheme: crypto.RSAPKCS1v15}).Sign(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rsa.VerifyPKCS1v15(keyPair.Public, gocrypto.SHA256, digest[:], pkcs1); err != nil {
+		t.Fatal(err)
+	}
+
+	pss, err := crypto.NewRSASigner(keyPair, crypto.Config{RSAScheme: crypto.RSAPSS}).Sign(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rsa.VerifyPSS(keyPair.Public, gocrypto.SHA256, digest[:], pss, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func getSigner() (crypto.Signer, error) {
-	generator := crypto.RSAGenerator{}
-	keyPair, err := generator.Generate()
+	keyPair, err := getRSAKeyPair()
 	if err != nil {
 		return nil, err
 	}
 	return crypto.NewRSASigner(keyPair, crypto.Config{}), nil
 }
+
+func getRSAKeyPair() (*crypto.RSAKeyPair, error) {
+	generator := crypto.RSAGenerator{}
+	return generator.Generate()
+}
+
+func TestECCSigner_Sign_DER(t *testing.T) {
+	t.Parallel()
+
+	keyPair, err := (&crypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := crypto.NewECCSigner(keyPair, crypto.Config{}).Sign(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha512.Sum384(src)
+	if !ecdsa.VerifyASN1(keyPair.Public, digest[:], signature) {
+		t.Fatal(errors.New("DER signature doesn't verify"))
+	}
+}
+
+func TestECCSigner_Sign_P1363(t *testing.T) {
+	t.Parallel()
+
+	keyPair, err := (&crypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := crypto.NewECCSigner(keyPair, crypto.Config{ECDSAEncoding: crypto.ECDSAEncodingP1363})
+	digest := sha512.Sum384(src)
+
+	for n := 0; n < 10; n++ {
+		signature, errSign := signer.Sign(src)
+		if errSign != nil {
+			t.Fatal(errSign)
+		}
+		// P-384 scalars are 48 bytes, short r or s values are padded
+		if len(signature) != 96 {
+			t.Fatalf("expected 96 bytes, got %d", len(signature))
+		}
+
+		r := new(big.Int).SetBytes(signature[:48])
+		s := new(big.Int).SetBytes(signature[48:])
+		if !ecdsa.Verify(keyPair.Public, digest[:], r, s) {
+			t.Fatal(errors.New("P1363 signature doesn't verify"))
+		}
+	}
+}
+
+func TestEd25519Signer_Sign(t *testing.T) {
+	t.Parallel()
+
+	keyPair, err := (&crypto.Ed25519Generator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signer is built from the marshalled private key, as it is done for stored devices
+	_, private, err := crypto.NewEd25519Marshaller().Marshal(keyPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmarshalled, err := crypto.NewEd25519Marshaller().UnMarshal(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := crypto.NewEd25519Signer(unmarshalled.(*crypto.Ed25519KeyPair)).Sign(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ed25519.Verify(keyPair.Public, src, signature) {
+		t.Fatal(errors.New("Ed25519 signature doesn't verify"))
+	}
+}
+
+func TestSigner_Sign_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	rsaKeyPair, err := (&crypto.RSAGenerator{Bits: 2048}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eccKeyPair, err := (&crypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519KeyPair, err := (&crypto.Ed25519Generator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signers := []crypto.Signer{
+		crypto.NewRSASigner(rsaKeyPair, crypto.Config{RSAScheme: crypto.RSAPSS}),
+		crypto.NewECCSigner(eccKeyPair, crypto.Config{}),
+		crypto.NewEd25519Signer(ed25519KeyPair),
+	}
+
+	var wg sync.WaitGroup
+	for _, signer := range signers {
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func(signer crypto.Signer) {
+				defer wg.Done()
+
+				if _, errSign := signer.Sign(src); errSign != nil {
+					t.Error(errSign)
+				}
+			}(signer)
+		}
+	}
+	wg.Wait()
+}
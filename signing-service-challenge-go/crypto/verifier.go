@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+var ErrInvalidSignature = errors.New("signature doesn't match the data")
+
+// Verifier defines a contract for checking signatures created by a Signer with the public key only.
+// Implementations must be safe for concurrent use.
+type Verifier interface {
+	// Verify returns nil if signature is a valid signature of data, an error describing why not otherwise.
+	Verify(data, signature []byte) error
+}
+
+type RSAVerifier struct {
+	public *rsa.PublicKey
+
+	hash   gocrypto.Hash
+	scheme RSAScheme
+}
+
+type ECCVerifier struct {
+	public *ecdsa.PublicKey
+
+	hash     gocrypto.Hash
+	encoding ECDSAEncoding
+}
+
+type Ed25519Verifier struct {
+	public ed25519.PublicKey
+}
+
+// NewRSAVerifier returns new RSA implementation of Verifier, config.RSAScheme has to match the signer.
+func NewRSAVerifier(keyPair *RSAKeyPair, config Config) Verifier {
+	return &RSAVerifier{
+		public: keyPair.Public,
+		hash:   gocrypto.SHA256,
+		scheme: config.RSAScheme,
+	}
+}
+
+// NewECCVerifier returns new ecdsa implementation of Verifier, config.ECDSAEncoding has to match the signer.
+func NewECCVerifier(keyPair *ECCKeyPair, config Config) Verifier {
+	return &ECCVerifier{
+		public:   keyPair.Public,
+		hash:     CurveHash(keyPair.Public.Curve),
+		encoding: config.ECDSAEncoding,
+	}
+}
+
+// NewEd25519Verifier returns new Ed25519 implementation of Verifier
+func NewEd25519Verifier(keyPair *Ed25519KeyPair) Verifier {
+	return &Ed25519Verifier{public: keyPair.Public}
+}
+
+// NewPublicKeyVerifier returns the Verifier of a parsed public key, the key type has to match its algorithm.
+func NewPublicKeyVerifier(publicKey PublicKey, config Config) (Verifier, error) {
+	switch key := publicKey.Key.(type) {
+	case *rsa.PublicKey:
+		if publicKey.Algorithm == domain.RSAPKCS1SHA256 || publicKey.Algorithm == domain.RSAPSSSHA256 {
+			return NewRSAVerifier(&RSAKeyPair{Public: key}, config), nil
+		}
+	case *ecdsa.PublicKey:
+		if publicKey.Algorithm == domain.ECDSA {
+			return NewECCVerifier(&ECCKeyPair{Public: key}, config), nil
+		}
+	case ed25519.PublicKey:
+		if publicKey.Algorithm == domain.Ed25519 {
+			return NewEd25519Verifier(&Ed25519KeyPair{Public: key}), nil
+		}
+	}
+
+	return nil, ErrWrongKeyPairType
+}
+
+func (r *RSAVerifier) Verify(data, signature []byte) error {
+	digest := sum(r.hash, data)
+
+	var err error
+	if r.scheme == RSAPSS {
+		err = rsa.VerifyPSS(r.public, r.hash, digest, signature, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+		})
+	} else {
+		err = rsa.VerifyPKCS1v15(r.public, r.hash, digest, signature)
+	}
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func (e *ECCVerifier) Verify(data, signature []byte) error {
+	digest := sum(e.hash, data)
+
+	if e.encoding != ECDSAEncodingP1363 {
+		if !ecdsa.VerifyASN1(e.public, digest, signature) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	size := curveSize(e.public.Curve)
+	if len(signature) != 2*size {
+		return fmt.Errorf("%w: P1363 signature must be %d bytes long", ErrInvalidSignature, 2*size)
+	}
+
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(e.public, digest, r, s) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func (e *Ed25519Verifier) Verify(data, signature []byte) error {
+	if !ed25519.Verify(e.public, data, signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
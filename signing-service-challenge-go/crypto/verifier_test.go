@@ -0,0 +1,83 @@
+package crypto_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	t.Parallel()
+
+	rsaKeyPair, err := (&crypto.RSAGenerator{Bits: 2048}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eccKeyPair, err := (&crypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519KeyPair, err := (&crypto.Ed25519Generator{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPublic := publicOnly(t, crypto.NewRSAMarshaller(), rsaKeyPair).(*crypto.RSAKeyPair)
+	eccPublic := publicOnly(t, crypto.NewECCMarshaller(), eccKeyPair).(*crypto.ECCKeyPair)
+	ed25519Public := publicOnly(t, crypto.NewEd25519Marshaller(), ed25519KeyPair).(*crypto.Ed25519KeyPair)
+
+	pss := crypto.Config{RSAScheme: crypto.RSAPSS}
+	p1363 := crypto.Config{ECDSAEncoding: crypto.ECDSAEncodingP1363}
+
+	tests := []struct {
+		name     string
+		signer   crypto.Signer
+		verifier crypto.Verifier
+	}{
+		{"RSA PKCS#1 v1.5", crypto.NewRSASigner(rsaKeyPair, crypto.Config{}), crypto.NewRSAVerifier(rsaPublic, crypto.Config{})},
+		{"RSA PSS", crypto.NewRSASigner(rsaKeyPair, pss), crypto.NewRSAVerifier(rsaPublic, pss)},
+		{"ECDSA DER", crypto.NewECCSigner(eccKeyPair, crypto.Config{}), crypto.NewECCVerifier(eccPublic, crypto.Config{})},
+		{"ECDSA P1363", crypto.NewECCSigner(eccKeyPair, p1363), crypto.NewECCVerifier(eccPublic, p1363)},
+		{"Ed25519", crypto.NewEd25519Signer(ed25519KeyPair), crypto.NewEd25519Verifier(ed25519Public)},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			signature, errSign := tt.signer.Sign(src)
+			if errSign != nil {
+				t.Fatal(errSign)
+			}
+
+			if errVerify := tt.verifier.Verify(src, signature); errVerify != nil {
+				t.Fatal(errVerify)
+			}
+
+			tampered := append([]byte{}, src...)
+			tampered[0] ^= 0xff
+			if errVerify := tt.verifier.Verify(tampered, signature); !errors.Is(errVerify, crypto.ErrInvalidSignature) {
+				t.Fatalf("expected %v, got %v", crypto.ErrInvalidSignature, errVerify)
+			}
+		})
+	}
+}
+
+// publicOnly marshals the key pair and assembles it again from the public key only.
+func publicOnly(t *testing.T, marshaller crypto.KeyPairMarshaller, keyPair interface{}) interface{} {
+	t.Helper()
+
+	public, _, err := marshaller.Marshal(keyPair)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKeyPair, err := marshaller.UnMarshalPublic(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return publicKeyPair
+}
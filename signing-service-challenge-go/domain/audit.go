@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidChainStart = errors.New("a resumed chain needs a counter above 0 and the last signature")
+
+// ChainStart is where the signature chain of a device migrated from another system continues.
+// The first signature of the device links to LastSignature instead of the device ID.
+type ChainStart struct {
+	// Counter is the counter of the first signature created by this service.
+	Counter int64 `json:"counter"`
+	// LastSignature is the last signature the device created before the migration, with Counter-1.
+	LastSignature []byte `json:"last_signature"`
+}
+
+// Validate checks that the chain continues after at least one signature.
+func (c ChainStart) Validate() error {
+	if c.Counter < 1 || len(c.LastSignature) == 0 {
+		return ErrInvalidChainStart
+	}
+
+	return nil
+}
+
+// AuditAction is the kind of administrative change recorded in the audit trail.
+type AuditAction string
+
+const (
+	// AuditDeviceMigrated records the creation of a device that continues the chain of another system.
+	AuditDeviceMigrated AuditAction = "device_migrated"
+	// AuditKeyRotated records the replacement of the key pair of a device by a new version.
+	AuditKeyRotated AuditAction = "key_rotated"
+)
+
+// AuditRecord is an administrative change of a device. Records are only ever appended,
+// so they prove what was changed, by whom and when.
+type AuditRecord struct {
+	DeviceID uuid.UUID   `json:"device_id"`
+	Action   AuditAction `json:"action"`
+	Actor    string      `json:"actor"`
+	Detail   string      `json:"detail"`
+	At       time.Time   `json:"at"`
+}
+
+// DeviceMigration creates a device that continues the signature chain of a device of another system.
+type DeviceMigration struct {
+	Device Device
+	// PrivateKey is the PEM encoded key of the migrated device, a new key is generated if it's empty.
+	PrivateKey SecretKey
+	Passphrase SecretKey
+	Chain      ChainStart
+	// Actor is who requested the migration, it is recorded in the audit trail.
+	Actor string
+}
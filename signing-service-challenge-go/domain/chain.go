@@ -0,0 +1,44 @@
+package domain
+
+// ChainBreakReason tells which check of the signature chain failed.
+type ChainBreakReason string
+
+const (
+	BreakGap       ChainBreakReason = "gap"       // the counter is missing from the journal
+	BreakLink      ChainBreakReason = "link"      // the entry doesn't link to the previous signature
+	BreakData      ChainBreakReason = "data"      // the secured data or the data hash doesn't match the entry
+	BreakSignature ChainBreakReason = "signature" // the signature doesn't verify against the public key
+)
+
+// ChainBreak is the first broken link of a signature chain.
+type ChainBreak struct {
+	Counter int64            `json:"counter"`
+	Reason  ChainBreakReason `json:"reason"`
+	Detail  string           `json:"detail"`
+}
+
+// ChainReport is the result of the integrity check of the signature chain of a device.
+type ChainReport struct {
+	Valid bool `json:"valid"`
+	// Entries is the number of intact journal entries, the check stops at the first broken link.
+	Entries int64 `json:"entries"`
+	// SignatureCounter is the number of signatures the device created.
+	SignatureCounter int64 `json:"signature_counter"`
+	// VerifiedSignatures counts the signatures checked against the public key.
+	VerifiedSignatures int64 `json:"verified_signatures"`
+	// UnverifiedSignatures counts the entries of a journal that only keeps the hash of the data whose data
+	// wasn't supplied. Their counters and links are checked, their signatures aren't, so a chain is only
+	// verified completely if there are none.
+	UnverifiedSignatures int64       `json:"unverified_signatures"`
+	FirstBrokenLink      *ChainBreak `json:"first_broken_link,omitempty"`
+}
+
+// ChainExport is the signature chain of a device with everything needed to check it offline.
+type ChainExport struct {
+	Device Device
+	// PublicKeys are the PEM encoded public keys of all key versions of the device, by version.
+	PublicKeys       map[int][]byte
+	SignatureCounter int64
+	// Entries are the journal entries of an export read back from a file, the service streams them instead.
+	Entries []JournalEntry
+}
@@ -3,6 +3,7 @@ package domain
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -10,26 +11,122 @@ import (
 type Algorithm int
 
 const (
-	RSA   Algorithm = iota
-	ECDSA Algorithm = iota
+	RSAPKCS1SHA256 Algorithm = iota // RSASSA-PKCS1-v1_5 with SHA-256
+	ECDSA          Algorithm = iota
+	RSAPSSSHA256   Algorithm = iota // RSASSA-PSS with SHA-256
+	Ed25519        Algorithm = iota // PureEdDSA on edwards25519
 )
 
+// RSA is the default RSA signature scheme.
+const RSA = RSAPKCS1SHA256
+
+// SignatureEncoding defines how the signatures of a device are serialized.
+// It only applies to ECDSA, RSA signatures have a single standard encoding.
+type SignatureEncoding int
+
+const (
+	EncodingDER   SignatureEncoding = iota // ASN.1 DER SEQUENCE { r, s }
+	EncodingP1363 SignatureEncoding = iota // fixed-width r||s, IEEE P1363
+)
+
+// KeyStorage is where the private key of a device is held.
+type KeyStorage string
+
+const (
+	// KeyStorageSoftware keeps the encoded private key in the repository, sealed if key encryption is enabled.
+	KeyStorageSoftware KeyStorage = "software"
+	// KeyStoragePKCS11 keeps the private key on a PKCS#11 token it never leaves,
+	// the repository only holds a reference to the key object.
+	KeyStoragePKCS11 KeyStorage = "pkcs11"
+)
+
+// Valid reports whether the key storage is known.
+func (s KeyStorage) Valid() bool {
+	return s == KeyStorageSoftware || s == KeyStoragePKCS11
+}
+
+// DeviceStatus is the lifecycle state of a device.
+type DeviceStatus string
+
 var (
 	ErrNotFound           = errors.New("not found")
 	ErrDeviceNotFound     = fmt.Errorf("device %f", ErrNotFound)
 	ErrDeviceAlreadyExist = fmt.Errorf("device already exist")
+	ErrEncodingNotAllowed = errors.New("signature encoding isn't supported by the algorithm")
+	// ErrKeyStorageNotAvailable is returned for devices of a key storage the service isn't configured with.
+	ErrKeyStorageNotAvailable = errors.New("key storage isn't available")
+	// ErrKeyStorageAlgorithm is returned for algorithms the key storage can't generate keys for.
+	ErrKeyStorageAlgorithm = errors.New("algorithm isn't supported by the key storage")
 )
 
 type Device struct {
 	ID        uuid.UUID `json:"id"`
 	Algorithm Algorithm `json:"algorithm"`
 	Label     *string   `json:"label"`
+	// Encoding is the serialization of the signatures, external verifiers need it to parse them.
+	Encoding SignatureEncoding `json:"signature_encoding"`
+	// Curve is the elliptic curve of ECDSA devices.
+	Curve Curve `json:"curve,omitempty"`
+	// KeySize is the modulus length in bits of RSA devices.
+	KeySize int `json:"key_size,omitempty"`
+	// KeyVersion is the version of the key pair of the device, starting at 1.
+	KeyVersion int `json:"key_version"`
+	// KeyStorage is where the private key is held, it decides how DeviceKeyPairRaw.PrivateKey is read.
+	KeyStorage KeyStorage   `json:"key_storage"`
+	Status     DeviceStatus `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+	// ChainStart is set for devices migrated from another system, their chain doesn't start at counter 0.
+	ChainStart *ChainStart `json:"chain_start,omitempty"`
+}
+
+// KeyID identifies a version of the key of a device, e.g. as kid of a JSON Web Key.
+func KeyID(deviceID uuid.UUID, version int) string {
+	return fmt.Sprintf("%s:%d", deviceID, version)
+}
+
+// DeviceUpdate holds the user controlled fields of a device, nil fields stay unchanged.
+type DeviceUpdate struct {
+	Label *string
+	// Status moves the device through its lifecycle, Reason is recorded with the transition.
+	Status *DeviceStatus
+	Reason string
+}
+
+// Apply sets the fields of the update on the device.
+func (u DeviceUpdate) Apply(device *Device) {
+	if u.Label != nil {
+		device.Label = u.Label
+	}
+}
+
+// ChainOrigin returns the counter of the first signature of the device and the signature it links to,
+// which is empty unless the chain was resumed from another system.
+func (d Device) ChainOrigin() (counter int64, lastSignature []byte) {
+	if d.ChainStart == nil {
+		return 0, nil
+	}
+
+	return d.ChainStart.Counter, d.ChainStart.LastSignature
 }
 
 type DeviceKeyPairRaw struct {
 	Device
-	PublicKey  []byte `json:"pub_key"`
-	PrivateKey []byte `json:"private_key"`
+	PublicKey []byte `json:"pub_key"`
+	// PrivateKey is the encoded private key, or the reference to it for keys that don't leave their KeyStorage.
+	PrivateKey SecretKey `json:"-"`
+}
+
+// DeviceDetails is a device together with the state of its signature chain.
+type DeviceDetails struct {
+	Device
+	// SignatureCounter is the number of signatures created by the device.
+	SignatureCounter int64
+	// LastSignature is the latest signature, empty before the first signature.
+	LastSignature []byte
+	// KeyFingerprint is the hex encoded SHA-256 digest of the DER encoded public key.
+	KeyFingerprint string
+	// StatusHistory lists the lifecycle transitions of the device, oldest first.
+	StatusHistory []StatusTransition
 }
 
 type SignedTransaction struct {
@@ -37,4 +134,16 @@ type SignedTransaction struct {
 	Counter       int64  `json:"counter"`
 	RawData       string `json:"raw_data"`
 	LastSignature string `json:"last_signature"`
+	SignedData    string `json:"signed_data"`
+	// KeyVersion is the version of the device key that created the signature.
+	KeyVersion int `json:"key_version"`
+}
+
+// Verification is the result of checking a signature against the public key of a device.
+type Verification struct {
+	Valid bool `json:"valid"`
+	// Reason explains why an invalid signature was rejected.
+	Reason string `json:"reason,omitempty"`
+	// KeyVersion is the version of the device key that created a valid signature.
+	KeyVersion int `json:"key_version,omitempty"`
 }
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrSignatureNotFound = errors.New("signature not found")
+)
+
+// JournalEntry is a signature in the append-only journal of a device.
+type JournalEntry struct {
+	Counter int64
+	// RawData is the signed transaction data, empty when the journal only keeps its hash.
+	RawData string
+	// RawDataHash is the SHA-256 digest of the transaction data.
+	RawDataHash []byte
+	// SecuredData is the payload that was actually signed, see service.SecuredData. When the journal only
+	// keeps the hash of the data, the data is replaced by its hash, see service.RedactSecuredData.
+	SecuredData string
+	Signature   []byte
+	// LastSignature is the base64 encoded link to the previous signature of the chain.
+	LastSignature string
+	// KeyVersion is the version of the key of the device that created the signature.
+	KeyVersion int
+	CreatedAt  time.Time
+}
+
+// JournalQuery selects a page of journal entries by counter range.
+type JournalQuery struct {
+	// From is the first counter of the page.
+	From int64
+	// To is the last counter of the range, nil selects up to the latest signature.
+	To    *int64
+	Limit int
+}
+
+// Normalize applies the default page size.
+func (q *JournalQuery) Normalize() {
+	if q.From < 0 {
+		q.From = 0
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+}
+
+// Contains reports whether counter is in the range of the query.
+func (q JournalQuery) Contains(counter int64) bool {
+	return counter >= q.From && (q.To == nil || counter <= *q.To)
+}
+
+// JournalPage is a page of the journal of a device.
+type JournalPage struct {
+	Entries []JournalEntry
+	// NextFrom is the first counter of the next page, nil on the last page.
+	NextFrom *int64
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrKeyRotationNotAllowed = errors.New("keys of decommissioned devices can't be rotated")
+	// ErrKeyVersionChanged is returned when the key of a device was rotated by another request meanwhile.
+	ErrKeyVersionChanged = errors.New("key of the device was rotated concurrently")
+)
+
+// DeviceKey is a version of the key pair of a device. A rotation retires the current version for signing,
+// its public key stays available, so the signatures it created remain verifiable.
+type DeviceKey struct {
+	Version   int       `json:"version"`
+	PublicKey []byte    `json:"public_key"`
+	CreatedAt time.Time `json:"created_at"`
+	// RetiredAt is when the version was replaced, it is nil for the current version.
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// CanRotateKey reports whether the key of a device in the status can be rotated.
+// Decommissioned devices never sign again, a new key would never be used.
+func (s DeviceStatus) CanRotateKey() bool {
+	return s != StatusDecommissioned
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Lifecycle states of a device. A device starts initialized, only active devices sign.
+// Suspended devices can be reactivated, decommissioned devices stay readable but never sign again.
+const (
+	StatusInitialized    DeviceStatus = "initialized"
+	StatusActive         DeviceStatus = "active"
+	StatusSuspended      DeviceStatus = "suspended"
+	StatusDecommissioned DeviceStatus = "decommissioned"
+)
+
+var (
+	ErrDeviceNotActive   = errors.New("device is not active")
+	ErrInvalidTransition = errors.New("device status transition isn't allowed")
+	ErrReasonRequired    = errors.New("device status transition requires a reason")
+)
+
+// transitions lists the allowed target states of each state:
+// initialized → active → suspended ↔ active → decommissioned.
+var transitions = map[DeviceStatus][]DeviceStatus{
+	StatusInitialized:    {StatusActive},
+	StatusActive:         {StatusSuspended, StatusDecommissioned},
+	StatusSuspended:      {StatusActive},
+	StatusDecommissioned: nil,
+}
+
+// Valid reports whether the status is a known lifecycle state.
+func (s DeviceStatus) Valid() bool {
+	_, ok := transitions[s]
+
+	return ok
+}
+
+// CanTransition reports whether a device in state s may move to state to.
+func (s DeviceStatus) CanTransition(to DeviceStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatusTransition records a change of the lifecycle state of a device.
+type StatusTransition struct {
+	From   DeviceStatus `json:"from"`
+	To     DeviceStatus `json:"to"`
+	Reason string       `json:"reason"`
+	At     time.Time    `json:"at"`
+}
+
+// Transition moves the device to the status to and returns the record of the change.
+func (d *Device) Transition(to DeviceStatus, reason string, at time.Time) (StatusTransition, error) {
+	if reason == "" {
+		return StatusTransition{}, ErrReasonRequired
+	}
+	if !d.Status.CanTransition(to) {
+		return StatusTransition{}, ErrInvalidTransition
+	}
+
+	transition := StatusTransition{
+		From:   d.Status,
+		To:     to,
+		Reason: reason,
+		At:     at,
+	}
+	d.Status = to
+
+	return transition, nil
+}
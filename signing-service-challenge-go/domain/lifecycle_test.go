@@ -0,0 +1,66 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestDevice_Transition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		from    domain.DeviceStatus
+		to      domain.DeviceStatus
+		wantErr error
+	}{
+		{from: domain.StatusInitialized, to: domain.StatusActive},
+		{from: domain.StatusInitialized, to: domain.StatusSuspended, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusActive, to: domain.StatusSuspended},
+		{from: domain.StatusActive, to: domain.StatusActive, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusActive, to: domain.StatusInitialized, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusSuspended, to: domain.StatusActive},
+		{from: domain.StatusSuspended, to: domain.StatusDecommissioned, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusInitialized, to: domain.StatusDecommissioned, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusActive, to: domain.StatusDecommissioned},
+		{from: domain.StatusDecommissioned, to: domain.StatusActive, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusDecommissioned, to: domain.StatusSuspended, wantErr: domain.ErrInvalidTransition},
+		{from: domain.StatusActive, to: "deleted", wantErr: domain.ErrInvalidTransition},
+	}
+
+	at := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			t.Parallel()
+
+			device := domain.Device{Status: tt.from}
+			transition, err := device.Transition(tt.to, "reason", at)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				if device.Status != tt.from {
+					t.Fatalf("status changed to %s on a rejected transition", device.Status)
+				}
+				return
+			}
+
+			want := domain.StatusTransition{From: tt.from, To: tt.to, Reason: "reason", At: at}
+			if transition != want || device.Status != tt.to {
+				t.Fatalf("expected %+v, got %+v with status %s", want, transition, device.Status)
+			}
+		})
+	}
+}
+
+func TestDevice_TransitionRequiresReason(t *testing.T) {
+	t.Parallel()
+
+	device := domain.Device{Status: domain.StatusActive}
+	if _, err := device.Transition(domain.StatusSuspended, "", time.Now()); !errors.Is(err, domain.ErrReasonRequired) {
+		t.Fatalf("expected %v, got %v", domain.ErrReasonRequired, err)
+	}
+}
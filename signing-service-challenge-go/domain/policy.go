@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Curve is the name of the elliptic curve of an ECDSA device.
+type Curve string
+
+const (
+	CurveP256 Curve = "P-256"
+	CurveP384 Curve = "P-384"
+	CurveP521 Curve = "P-521"
+)
+
+var (
+	ErrKeyParamsNotAllowed = errors.New("key parameters aren't allowed")
+	// ErrKeyAlgorithmMismatch is returned for imported keys that don't match the algorithm or key parameters of the device.
+	ErrKeyAlgorithmMismatch = errors.New("key doesn't match the algorithm of the device")
+)
+
+// KeyPolicy is the allow-list of key parameters that devices can be created with.
+type KeyPolicy struct {
+	Curves      []Curve
+	RSAKeySizes []int
+
+	DefaultCurve      Curve
+	DefaultRSAKeySize int
+
+	// MaxImportRSAKeySize is the upper bound of the moduli of imported RSA keys, unlimited if zero.
+	MaxImportRSAKeySize int
+}
+
+// DefaultKeyPolicy allows the NIST curves P-256, P-384, P-521 and RSA moduli of 2048, 3072 and 4096 bits.
+// Imported RSA keys may have any modulus from 2048 up to 8192 bits.
+var DefaultKeyPolicy = KeyPolicy{
+	Curves:              []Curve{CurveP256, CurveP384, CurveP521},
+	RSAKeySizes:         []int{2048, 3072, 4096},
+	DefaultCurve:        CurveP384,
+	DefaultRSAKeySize:   4096,
+	MaxImportRSAKeySize: 8192,
+}
+
+// Apply fills in the default key parameters of the device and validates them against the allow-list.
+func (p KeyPolicy) Apply(device *Device) error {
+	return p.apply(device, p.allowsKeySize)
+}
+
+// ApplyImport validates the key parameters of a device with an imported key. The key size of RSA keys
+// isn't limited to the allow-list keys are generated with, it only has to be at least the smallest size
+// of the allow-list and at most MaxImportRSAKeySize. Keys of other legacy systems often have other sizes.
+func (p KeyPolicy) ApplyImport(device *Device) error {
+	return p.apply(device, p.allowsImportKeySize)
+}
+
+func (p KeyPolicy) apply(device *Device, allowsKeySize func(size int) bool) error {
+	switch device.Algorithm {
+	case RSAPKCS1SHA256, RSAPSSSHA256:
+		if device.Curve != "" {
+			return fmt.Errorf("%w: curve isn't supported by RSA", ErrKeyParamsNotAllowed)
+		}
+		if device.KeySize == 0 {
+			device.KeySize = p.DefaultRSAKeySize
+		}
+		if !allowsKeySize(device.KeySize) {
+			return fmt.Errorf("%w: RSA key size %d", ErrKeyParamsNotAllowed, device.KeySize)
+		}
+	case ECDSA:
+		if device.KeySize != 0 {
+			return fmt.Errorf("%w: key size isn't supported by ECDSA", ErrKeyParamsNotAllowed)
+		}
+		if device.Curve == "" {
+			device.Curve = p.DefaultCurve
+		}
+		if !p.allowsCurve(device.Curve) {
+			return fmt.Errorf("%w: curve %s", ErrKeyParamsNotAllowed, device.Curve)
+		}
+	default:
+		if device.Curve != "" || device.KeySize != 0 {
+			return fmt.Errorf("%w: the algorithm has fixed key parameters", ErrKeyParamsNotAllowed)
+		}
+	}
+
+	if device.Encoding != EncodingDER && device.Algorithm != ECDSA {
+		return ErrEncodingNotAllowed
+	}
+
+	return nil
+}
+
+func (p KeyPolicy) allowsCurve(curve Curve) bool {
+	for _, c := range p.Curves {
+		if c == curve {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p KeyPolicy) allowsKeySize(size int) bool {
+	for _, s := range p.RSAKeySizes {
+		if s == size {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p KeyPolicy) allowsImportKeySize(size int) bool {
+	if p.MaxImportRSAKeySize != 0 && size > p.MaxImportRSAKeySize {
+		return false
+	}
+	for _, s := range p.RSAKeySizes {
+		if size >= s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestKeyPolicy_Apply(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		device  domain.Device
+		want    domain.Device
+		wantErr error
+	}{
+		{
+			name:   "RSA default key size",
+			device: domain.Device{Algorithm: domain.RSAPSSSHA256},
+			want:   domain.Device{Algorithm: domain.RSAPSSSHA256, KeySize: 4096},
+		},
+		{
+			name:   "RSA allowed key size",
+			device: domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 2048},
+			want:   domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 2048},
+		},
+		{
+			name:    "RSA weak key size",
+			device:  domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 1024},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+		{
+			name:    "RSA with curve",
+			device:  domain.Device{Algorithm: domain.RSAPKCS1SHA256, Curve: domain.CurveP256},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+		{
+			name:   "ECDSA default curve",
+			device: domain.Device{Algorithm: domain.ECDSA},
+			want:   domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP384},
+		},
+		{
+			name:   "ECDSA allowed curve",
+			device: domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP521, Encoding: domain.EncodingP1363},
+			want:   domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP521, Encoding: domain.EncodingP1363},
+		},
+		{
+			name:    "ECDSA unknown curve",
+			device:  domain.Device{Algorithm: domain.ECDSA, Curve: "P-224"},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+		{
+			name:    "Ed25519 with key size",
+			device:  domain.Device{Algorithm: domain.Ed25519, KeySize: 2048},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+		{
+			name:    "Ed25519 with P1363 encoding",
+			device:  domain.Device{Algorithm: domain.Ed25519, Encoding: domain.EncodingP1363},
+			wantErr: domain.ErrEncodingNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			device := tt.device
+			err := domain.DefaultKeyPolicy.Apply(&device)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && device != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, device)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_ApplyImport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		device  domain.Device
+		wantErr error
+	}{
+		{name: "RSA key size of the allow-list", device: domain.Device{Algorithm: domain.RSAPSSSHA256, KeySize: 2048}},
+		{name: "RSA key size between the allow-list", device: domain.Device{Algorithm: domain.RSAPSSSHA256, KeySize: 2560}},
+		{name: "RSA key size above the allow-list", device: domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 8192}},
+		{
+			name:    "RSA weak key size",
+			device:  domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 2047},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+		{
+			name:    "RSA key size above the upper bound",
+			device:  domain.Device{Algorithm: domain.RSAPKCS1SHA256, KeySize: 16384},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+		{name: "ECDSA allowed curve", device: domain.Device{Algorithm: domain.ECDSA, Curve: domain.CurveP256}},
+		{
+			name:    "ECDSA unknown curve",
+			device:  domain.Device{Algorithm: domain.ECDSA, Curve: "P-224"},
+			wantErr: domain.ErrKeyParamsNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			device := tt.device
+			if err := domain.DefaultKeyPolicy.ApplyImport(&device); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// generated keys are still limited to the allow-list
+	device := domain.Device{Algorithm: domain.RSAPSSSHA256, KeySize: 2560}
+	if err := domain.DefaultKeyPolicy.Apply(&device); !errors.Is(err, domain.ErrKeyParamsNotAllowed) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyParamsNotAllowed, err)
+	}
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort order")
+)
+
+// DeviceSort is the order of a device listing, a leading "-" sorts descending.
+type DeviceSort string
+
+const (
+	SortCreatedAtAsc  DeviceSort = "created_at"
+	SortCreatedAtDesc DeviceSort = "-created_at"
+	SortLabelAsc      DeviceSort = "label"
+	SortLabelDesc     DeviceSort = "-label"
+)
+
+// Valid reports whether the sort order is known.
+func (s DeviceSort) Valid() bool {
+	switch s {
+	case SortCreatedAtAsc, SortCreatedAtDesc, SortLabelAsc, SortLabelDesc:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceQuery selects a page of devices. Zero values of the filters match every device.
+type DeviceQuery struct {
+	Algorithm    *Algorithm
+	Status       DeviceStatus
+	LabelPrefix  string
+	CreatedAfter time.Time
+
+	Sort DeviceSort
+	// Cursor is the opaque position after the last device of the previous page, empty for the first page.
+	Cursor string
+	Limit  int
+}
+
+// Normalize applies the default sort order and page size.
+func (q *DeviceQuery) Normalize() {
+	if q.Sort == "" {
+		q.Sort = SortCreatedAtAsc
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+}
+
+// DevicePage is a page of a device listing.
+type DevicePage struct {
+	Devices []Device
+	// NextCursor continues the listing, it is empty on the last page.
+	NextCursor string
+}
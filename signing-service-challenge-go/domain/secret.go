@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"fmt"
+)
+
+const redacted = "[REDACTED]"
+
+// SecretKey holds encoded private key material. It can't be serialized or printed:
+// JSON, text and fmt output only ever show a placeholder, so the key can't leak through responses or logs.
+type SecretKey []byte
+
+// MarshalJSON implements json.Marshaler.
+func (SecretKey) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (SecretKey) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// String implements fmt.Stringer.
+func (SecretKey) String() string {
+	return redacted
+}
+
+// Format implements fmt.Formatter, so verbs like %x or %v don't print the bytes either.
+func (SecretKey) Format(f fmt.State, _ rune) {
+	f.Write([]byte(redacted)) //nolint:errcheck
+}
@@ -0,0 +1,41 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+func TestSecretKeyIsNeverSerialized(t *testing.T) {
+	t.Parallel()
+
+	const material = "super-secret-key-material"
+	raw := domain.DeviceKeyPairRaw{PublicKey: []byte("public"), PrivateKey: domain.SecretKey(material)}
+
+	body, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "private_key") || strings.Contains(string(body), "c3VwZXIt") {
+		t.Fatalf("private key serialized: %s", body)
+	}
+
+	wrapped, err := json.Marshal(struct {
+		Key domain.SecretKey `json:"key"`
+	}{Key: raw.PrivateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(wrapped), "c3VwZXIt") {
+		t.Fatalf("private key serialized: %s", wrapped)
+	}
+
+	for _, format := range []string{"%v", "%+v", "%s", "%x", "%q"} {
+		if out := fmt.Sprintf(format, raw); strings.Contains(out, material) || strings.Contains(out, fmt.Sprintf("%x", material)) {
+			t.Fatalf("%s leaked the private key: %s", format, out)
+		}
+	}
+}
@@ -3,7 +3,11 @@ module github.com/fiskaly/coding-challenges/signing-service-challenge
 go 1.16
 
 require (
-	github.com/go-playground/validator/v10 v10.11.0 // indirect
+	github.com/go-playground/validator/v10 v10.11.0
 	github.com/google/uuid v1.3.0
+	github.com/lib/pq v1.10.9
+	github.com/miekg/pkcs11 v1.1.1
+	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a
 	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3 // indirect
+	modernc.org/sqlite v1.17.3
 )
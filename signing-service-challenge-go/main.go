@@ -2,12 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"log"
-	"sync"
+	"os"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
-	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
@@ -20,41 +21,62 @@ const (
 var ErrWrongType = errors.New("wrong type cast")
 
 func main() {
-	factory := service.NewAlgorithmFactoryV0()
-	factory.Add(domain.RSA, func(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error) {
-		m := crypto.NewRSAMarshaller()
-		keyPairRaw, err := m.UnMarshal(privateKey)
-		if err != nil {
-			return nil, err
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify-chain":
+			os.Exit(verifyChain(os.Args[2:], os.Stdout, os.Stderr))
+		case "rewrap-keys":
+			os.Exit(rewrapKeys(os.Stdout, os.Stderr))
 		}
+	}
 
-		keyPair, ok := keyPairRaw.(*crypto.RSAKeyPair)
-		if !ok {
-			return nil, ErrWrongType
-		}
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
 
-		return crypto.NewRSASigner(keyPair, crypto.Config{}), nil
-	})
+// run serves the API until the server fails. Its deferred calls close the storage and the PKCS#11 token,
+// which log.Fatal in main wouldn't run.
+func run() error {
+	repo := repository()
+	if closer, ok := repo.(io.Closer); ok {
+		defer closer.Close()
+	}
+	kek := keyEncryption()
 
-	factory.Add(domain.ECDSA, func(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error) {
-		m := crypto.NewECCMarshaller()
-		keyPairRaw, err := m.UnMarshal(privateKey)
-		if err != nil {
-			return nil, err
-		}
+	pool := crypto.NewKeyPool(keyPoolConfigs(domain.DefaultKeyPolicy))
+	pool.Start()
 
-		keyPair, ok := keyPairRaw.(*crypto.ECCKeyPair)
-		if !ok {
-			return nil, ErrWrongType
-		}
-		return crypto.NewECCSigner(keyPair, crypto.Config{}), nil
-	})
-	repo := persistence.NewInMemoryRepository(&sync.RWMutex{})
-	signature := service.NewV0Signature(repo, factory)
+	options := []service.Option{
+		service.WithVerifierFactory(verifierFactory()),
+		service.WithKeyPairSource(pool),
+		service.WithSignerCache(service.NewSignerCache(envInt("SIGNER_CACHE_SIZE", DefaultSignerCacheSize))),
+		service.WithJournalData(journalData()),
+	}
+	factory := signerFactory()
+	if kek != nil {
+		factory = service.NewSealedAlgorithmFactory(factory, kek)
+		options = append(options, service.WithKeyEncryption(kek))
+	}
+	if token := pkcs11Token(); token != nil {
+		defer token.Close()
+
+		factory = service.NewKeyStorageAlgorithmFactory(factory, domain.KeyStoragePKCS11,
+			func(device domain.Device, ref []byte) (crypto.Signer, error) {
+				return token.Signer(device, ref, signerConfig(device))
+			})
+		options = append(options, service.WithKeyStorage(domain.KeyStoragePKCS11, token))
+	}
+
+	signature := service.NewV0Signature(repo, factory, options...)
 
-	server := api.NewServer(ListenAddress, signature)
+	server := api.NewServer(ListenAddress, signature, pool)
+	// the admin routes stay disabled without tokens
+	server.EnableAdmin(adminTokens())
 
 	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+		return fmt.Errorf("could not start server on %s: %w", ListenAddress, err)
 	}
+
+	return nil
 }
@@ -0,0 +1,69 @@
+package persistence
+
+import (
+	"sort"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// deviceIndex holds the positions of all devices in ascending order of a sort key. A page is found by a binary
+// search for its cursor, descending orders walk the index backwards.
+type deviceIndex struct {
+	order     domain.DeviceSort
+	positions []cursor
+}
+
+func newDeviceIndex(order domain.DeviceSort) *deviceIndex {
+	return &deviceIndex{order: order}
+}
+
+// search returns the index of the first position that isn't before c.
+func (x *deviceIndex) search(c cursor) int {
+	return sort.Search(len(x.positions), func(n int) bool {
+		return compare(x.order, x.positions[n], c) >= 0
+	})
+}
+
+func (x *deviceIndex) insert(c cursor) {
+	n := x.search(c)
+	x.positions = append(x.positions, cursor{})
+	copy(x.positions[n+1:], x.positions[n:])
+	x.positions[n] = c
+}
+
+func (x *deviceIndex) remove(c cursor) {
+	n := x.search(c)
+	if n < len(x.positions) && x.positions[n].ID == c.ID {
+		x.positions = append(x.positions[:n], x.positions[n+1:]...)
+	}
+}
+
+// walk calls fn with the positions after the cursor in the order of sort until fn returns false,
+// after is ignored without a cursor.
+func (x *deviceIndex) walk(order domain.DeviceSort, after cursor, hasAfter bool, fn func(c cursor) bool) {
+	if order == x.order {
+		n := 0
+		if hasAfter {
+			n = sort.Search(len(x.positions), func(n int) bool {
+				return compare(x.order, x.positions[n], after) > 0
+			})
+		}
+		for ; n < len(x.positions); n++ {
+			if !fn(x.positions[n]) {
+				return
+			}
+		}
+
+		return
+	}
+
+	n := len(x.positions) - 1
+	if hasAfter {
+		n = x.search(after) - 1
+	}
+	for ; n >= 0; n-- {
+		if !fn(x.positions[n]) {
+			return
+		}
+	}
+}
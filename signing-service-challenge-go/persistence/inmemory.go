@@ -2,8 +2,9 @@ package persistence
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
-	"sync/atomic"
 
 	"github.com/google/uuid"
 
@@ -14,25 +15,129 @@ const initCounter = int64(-1)
 
 var (
 	ErrNotFound = errors.New("not found")
+	// ErrSignatureNotFound is returned for unknown counters of a known device.
+	ErrSignatureNotFound = fmt.Errorf("signature %w", ErrNotFound)
+	// ErrAlreadyExists is returned when a device is saved with the ID of a stored device.
+	ErrAlreadyExists = errors.New("already exists")
 )
 
+// Reservation is the chain state of a device that is locked for the creation of a single signature.
+type Reservation struct {
+	Device domain.DeviceKeyPairRaw
+	// Counter is the signature counter reserved for the new signature.
+	Counter int64
+	// LastSignature is the signature created with Counter-1, it is empty for the first signature.
+	LastSignature []byte
+}
+
+// SignFunc creates the signature for a reserved counter and returns its journal entry.
+// Returning an error rolls the reservation back, so the counter is not consumed.
+type SignFunc func(reservation Reservation) (domain.JournalEntry, error)
+
+// RotateFunc returns the next key version of the device together with its private key and records.
+// Returning an error leaves the device unchanged.
+type RotateFunc func(device domain.Device) (KeyRotation, error)
+
+// KeyRotation is the next key version of a device together with the records that are stored with it.
+type KeyRotation struct {
+	Key        domain.DeviceKey
+	PrivateKey []byte
+	// Audit holds the audit records of the rotation.
+	Audit []domain.AuditRecord
+}
+
+// TransitionFunc changes the status of a device and returns the record of the change.
+// Returning an error leaves the device unchanged.
+type TransitionFunc func(device *domain.Device) (domain.StatusTransition, error)
+
+// DeviceCreation is a new device together with the records that are stored with it.
+type DeviceCreation struct {
+	Device *domain.DeviceKeyPairRaw
+	// History holds the transitions of the device on creation, its status is the target of the last one.
+	History []domain.StatusTransition
+	// Audit holds the audit records of the creation, e.g. of a migration.
+	Audit []domain.AuditRecord
+}
+
+// DeviceState is a device together with the head of its signature chain and its lifecycle, read at once.
+type DeviceState struct {
+	Device domain.DeviceKeyPairRaw
+	// Counter is the counter of the last signature, -1 before the first signature.
+	Counter int64
+	// LastSignature is the signature with Counter, the last signature of the migrated device for a resumed
+	// chain and empty before the first signature.
+	LastSignature []byte
+	// History lists the lifecycle transitions of the device, oldest first.
+	History []domain.StatusTransition
+}
+
 type DeviceSignatureRepository interface {
+	// SaveDevice stores a new device, a device with the same ID is rejected with ErrAlreadyExists.
 	SaveDevice(device *domain.DeviceKeyPairRaw) (uuid.UUID, error)
+	// CreateDevice stores a new device together with its records in one transaction,
+	// a device with the same ID is rejected with ErrAlreadyExists.
+	CreateDevice(creation DeviceCreation) (uuid.UUID, error)
 	GetDevice(deviceID uuid.UUID) (domain.DeviceKeyPairRaw, error)
-	GetAndSaveSignature(deviceID uuid.UUID, data []byte) (signature []byte, count int64, err error)
+	// GetDeviceState returns the device, its chain head and its status history as they were at one point in
+	// time, no signature, rotation or transition is committed in between.
+	GetDeviceState(deviceID uuid.UUID) (DeviceState, error)
+	// ListDevices returns the page of devices selected by the normalized query and the cursor of the next page.
+	ListDevices(query domain.DeviceQuery) (devices []domain.DeviceKeyPairRaw, nextCursor string, err error)
+	// UpdateDevice applies update to the device and stores the result, unless update returns an error.
+	UpdateDevice(deviceID uuid.UUID, update func(device *domain.Device) error) (domain.Device, error)
+	// TransitionDevice applies transition to the device and stores its status and label together with the
+	// returned record. It waits for a running signature transaction of the device, so no signature commits after the status changed.
+	TransitionDevice(deviceID uuid.UUID, transition TransitionFunc) (domain.Device, error)
+	// UpdatePrivateKey replaces the stored private key of the device by the result of update,
+	// unless update returns an error. The public key stays the same.
+	UpdatePrivateKey(deviceID uuid.UUID, update func(privateKey []byte) ([]byte, error)) error
+	// RotateKey replaces the key pair of the device by the version returned by rotate and retires the
+	// current version, the audit records of the rotation are stored in the same transaction. It waits for a
+	// running signature transaction of the device, so every signature is committed with the key version that created it.
+	RotateKey(deviceID uuid.UUID, rotate RotateFunc) (domain.Device, error)
+	// DeviceKeys returns all key versions of the device, oldest first.
+	DeviceKeys(deviceID uuid.UUID) ([]domain.DeviceKey, error)
+	// ListDeviceKeys returns the key versions of the devices by device ID, oldest first.
+	// Unknown devices are left out.
+	ListDeviceKeys(deviceIDs []uuid.UUID) (map[uuid.UUID][]domain.DeviceKey, error)
+	// StatusHistory returns the lifecycle transitions of the device, oldest first.
+	StatusHistory(deviceID uuid.UUID) ([]domain.StatusTransition, error)
+	// SignTransaction reserves the next counter of the device, calls sign and commits the counter
+	// together with the returned journal entry. Signatures of one device are serialized, so counters
+	// are strictly monotonic and a failed sign never leaves a gap.
+	SignTransaction(deviceID uuid.UUID, sign SignFunc) error
 	GetSignatureAndCount(deviceID uuid.UUID) (signature []byte, count int64, err error)
+	// ListSignatures returns the journal entries of the device in the counter range of the normalized query,
+	// ordered by counter and at most query.Limit of them.
+	ListSignatures(deviceID uuid.UUID, query domain.JournalQuery) ([]domain.JournalEntry, error)
+	// GetSignature returns the journal entry of the device with the counter.
+	GetSignature(deviceID uuid.UUID, counter int64) (domain.JournalEntry, error)
+	// AddAuditRecord appends the record to the audit trail of its device.
+	AddAuditRecord(record domain.AuditRecord) error
+	// AuditTrail returns the audit records of the device, oldest first.
+	AuditTrail(deviceID uuid.UUID) ([]domain.AuditRecord, error)
 }
 
 type deviceKey struct {
 	domain.Device
 	pubKey     []byte
 	privateKey []byte
+
+	// mu serializes the signature transactions of the device.
+	mu *sync.Mutex
 }
 
 type InMemoryRepository struct {
 	devices   map[uuid.UUID]deviceKey
 	counter   map[uuid.UUID]int64
 	signature map[uuid.UUID][]byte
+	history   map[uuid.UUID][]domain.StatusTransition
+	// journal holds the signatures of each device ordered by counter, entries are only ever appended.
+	journal map[uuid.UUID][]domain.JournalEntry
+	audit   map[uuid.UUID][]domain.AuditRecord
+	keys    map[uuid.UUID][]domain.DeviceKey
+	// indexes order the devices by created_at and by label, descending listings walk them backwards.
+	indexes map[domain.DeviceSort]*deviceIndex
 
 	rw *sync.RWMutex
 }
@@ -43,71 +148,363 @@ func NewInMemoryRepository(rw *sync.RWMutex) *InMemoryRepository {
 		devices:   make(map[uuid.UUID]deviceKey),
 		counter:   make(map[uuid.UUID]int64),
 		signature: make(map[uuid.UUID][]byte),
+		history:   make(map[uuid.UUID][]domain.StatusTransition),
+		journal:   make(map[uuid.UUID][]domain.JournalEntry),
+		audit:     make(map[uuid.UUID][]domain.AuditRecord),
+		keys:      make(map[uuid.UUID][]domain.DeviceKey),
+		indexes: map[domain.DeviceSort]*deviceIndex{
+			domain.SortCreatedAtAsc: newDeviceIndex(domain.SortCreatedAtAsc),
+			domain.SortLabelAsc:     newDeviceIndex(domain.SortLabelAsc),
+		},
 	}
 }
 
 func (i *InMemoryRepository) SaveDevice(device *domain.DeviceKeyPairRaw) (uuid.UUID, error) {
-	if i.rw.TryLock() {
-		i.rw.Lock()
-		defer i.rw.Unlock()
+	return i.CreateDevice(DeviceCreation{Device: device})
+}
+
+func (i *InMemoryRepository) CreateDevice(creation DeviceCreation) (uuid.UUID, error) {
+	device := creation.Device
+
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	if _, ok := i.devices[device.ID]; ok {
+		return uuid.Nil, ErrAlreadyExists
 	}
 
 	i.devices[device.ID] = deviceKey{
-		Device:     device.Device,
+		Device:     detach(device.Device),
 		pubKey:     device.PublicKey,
 		privateKey: device.PrivateKey,
+		mu:         &sync.Mutex{},
 	}
+	i.index(device.Device)
+	i.keys[device.ID] = []domain.DeviceKey{{
+		Version:   device.KeyVersion,
+		PublicKey: device.PublicKey,
+		CreatedAt: device.CreatedAt,
+	}}
 
+	// a resumed chain continues after the last signature of the migrated device
 	i.counter[device.ID] = initCounter
+	if start := device.ChainStart; start != nil {
+		i.counter[device.ID] = start.Counter - 1
+		i.signature[device.ID] = append([]byte(nil), start.LastSignature...)
+	}
+	if len(creation.History) > 0 {
+		i.history[device.ID] = append([]domain.StatusTransition(nil), creation.History...)
+	}
+	if len(creation.Audit) > 0 {
+		i.audit[device.ID] = append([]domain.AuditRecord(nil), creation.Audit...)
+	}
 
 	return device.ID, nil
 }
 
 func (i *InMemoryRepository) GetDevice(deviceID uuid.UUID) (domain.DeviceKeyPairRaw, error) {
-	if i.rw.TryRLock() {
-		i.rw.RLock()
-		defer i.rw.RUnlock()
-	}
+	i.rw.RLock()
+	defer i.rw.RUnlock()
 
 	if device, ok := i.devices[deviceID]; ok {
-		return domain.DeviceKeyPairRaw{
-			Device: domain.Device{
-				ID:        deviceID,
-				Algorithm: device.Algorithm,
-				Label:     device.Label,
-			},
-			PublicKey:  device.pubKey,
-			PrivateKey: device.privateKey,
-		}, nil
+		return device.raw(), nil
 	}
 
 	return domain.DeviceKeyPairRaw{}, ErrNotFound
 }
 
-func (i *InMemoryRepository) GetAndSaveSignature(deviceID uuid.UUID, data []byte) (signature []byte, count int64, err error) {
-	if i.rw.TryLock() {
-		i.rw.Lock()
-		defer i.rw.Unlock()
+func (i *InMemoryRepository) GetDeviceState(deviceID uuid.UUID) (DeviceState, error) {
+	// signatures, rotations and transitions commit under the write lock
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	device, ok := i.devices[deviceID]
+	if !ok {
+		return DeviceState{}, ErrNotFound
 	}
 
-	signature, count, errGet := i.GetSignatureAndCount(deviceID)
-	if errors.Is(errGet, ErrNotFound) {
-		signature = data
+	history := make([]domain.StatusTransition, len(i.history[deviceID]))
+	copy(history, i.history[deviceID])
+
+	return DeviceState{
+		Device:        device.raw(),
+		Counter:       i.counter[deviceID],
+		LastSignature: i.signature[deviceID],
+		History:       history,
+	}, nil
+}
+
+func (i *InMemoryRepository) ListDevices(query domain.DeviceQuery) ([]domain.DeviceKeyPairRaw, string, error) {
+	var (
+		after    cursor
+		hasAfter = query.Cursor != ""
+	)
+	if hasAfter {
+		c, err := decodeCursor(query.Sort, query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = c
+	}
+
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	// one device more than the page tells whether there is a next page
+	devices := make([]domain.DeviceKeyPairRaw, 0, query.Limit+1)
+	i.indexOf(query.Sort).walk(query.Sort, after, hasAfter, func(c cursor) bool {
+		device := i.devices[c.ID]
+		if matches(query, device.Device) {
+			devices = append(devices, device.raw())
+		}
+
+		return len(devices) <= query.Limit
+	})
+
+	if len(devices) <= query.Limit {
+		return devices, "", nil
 	}
 
-	i.signature[deviceID] = data
+	devices = devices[:query.Limit]
 
-	atomic.AddInt64(&count, 1)
-	i.counter[deviceID] = count
+	return devices, EncodeCursor(query.Sort, devices[len(devices)-1].Device), nil
+}
+
+// indexOf returns the index that orders the devices by the sort key of order.
+func (i *InMemoryRepository) indexOf(order domain.DeviceSort) *deviceIndex {
+	if order == domain.SortLabelAsc || order == domain.SortLabelDesc {
+		return i.indexes[domain.SortLabelAsc]
+	}
 
-	return
+	return i.indexes[domain.SortCreatedAtAsc]
 }
 
-func (i *InMemoryRepository) GetSignatureAndCount(deviceID uuid.UUID) (signature []byte, count int64, err error) {
-	if i.rw.TryRLock() {
-		i.rw.RLock()
-		defer i.rw.RUnlock()
+func (i *InMemoryRepository) index(device domain.Device) {
+	for _, x := range i.indexes {
+		x.insert(position(device))
+	}
+}
+
+func (i *InMemoryRepository) unindex(device domain.Device) {
+	for _, x := range i.indexes {
+		x.remove(position(device))
+	}
+}
+
+func (i *InMemoryRepository) UpdateDevice(deviceID uuid.UUID, update func(device *domain.Device) error) (domain.Device, error) {
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	device, ok := i.devices[deviceID]
+	if !ok {
+		return domain.Device{}, ErrNotFound
+	}
+
+	updated := device.Device
+	if err := update(&updated); err != nil {
+		return domain.Device{}, err
+	}
+	// the identity and the key of a device never change through an update, its status only through a transition
+	updated.ID = device.ID
+	updated.KeyVersion = device.KeyVersion
+	updated.KeyStorage = device.KeyStorage
+	updated.Status = device.Status
+	updated.ChainStart = device.ChainStart
+
+	i.unindex(device.Device)
+	i.index(updated)
+	device.Device = detach(updated)
+	i.devices[deviceID] = device
+
+	return detach(updated), nil
+}
+
+func (i *InMemoryRepository) TransitionDevice(deviceID uuid.UUID, transition TransitionFunc) (domain.Device, error) {
+	i.rw.RLock()
+	device, ok := i.devices[deviceID]
+	i.rw.RUnlock()
+
+	if !ok {
+		return domain.Device{}, ErrNotFound
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	device = i.devices[deviceID]
+	updated := device.Device
+	record, err := transition(&updated)
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	i.unindex(device.Device)
+	device.Status = updated.Status
+	device.Label = updated.Label
+	i.index(device.Device)
+	device.Device = detach(device.Device)
+	i.devices[deviceID] = device
+	i.history[deviceID] = append(i.history[deviceID], record)
+
+	return detach(device.Device), nil
+}
+
+func (i *InMemoryRepository) UpdatePrivateKey(deviceID uuid.UUID, update func(privateKey []byte) ([]byte, error)) error {
+	i.rw.RLock()
+	device, ok := i.devices[deviceID]
+	i.rw.RUnlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	// a running signature transaction keeps the key it reserved
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	device = i.devices[deviceID]
+	privateKey, err := update(device.privateKey)
+	if err != nil {
+		return err
+	}
+
+	device.privateKey = privateKey
+	i.devices[deviceID] = device
+
+	return nil
+}
+
+func (i *InMemoryRepository) RotateKey(deviceID uuid.UUID, rotate RotateFunc) (domain.Device, error) {
+	i.rw.RLock()
+	device, ok := i.devices[deviceID]
+	i.rw.RUnlock()
+
+	if !ok {
+		return domain.Device{}, ErrNotFound
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	device = i.devices[deviceID]
+	rotation, err := rotate(detach(device.Device))
+	if err != nil {
+		return domain.Device{}, err
 	}
+	key := rotation.Key
+
+	// the versions are replaced, never changed in place, so earlier callers keep their copy
+	keys := make([]domain.DeviceKey, len(i.keys[deviceID]), len(i.keys[deviceID])+1)
+	copy(keys, i.keys[deviceID])
+	retiredAt := key.CreatedAt
+	keys[len(keys)-1].RetiredAt = &retiredAt
+	i.keys[deviceID] = append(keys, key)
+
+	device.KeyVersion = key.Version
+	device.pubKey = key.PublicKey
+	device.privateKey = rotation.PrivateKey
+	i.devices[deviceID] = device
+	i.audit[deviceID] = append(i.audit[deviceID], rotation.Audit...)
+
+	return detach(device.Device), nil
+}
+
+func (i *InMemoryRepository) DeviceKeys(deviceID uuid.UUID) ([]domain.DeviceKey, error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	if _, ok := i.devices[deviceID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	keys := make([]domain.DeviceKey, len(i.keys[deviceID]))
+	copy(keys, i.keys[deviceID])
+
+	return keys, nil
+}
+
+func (i *InMemoryRepository) ListDeviceKeys(deviceIDs []uuid.UUID) (map[uuid.UUID][]domain.DeviceKey, error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	keys := make(map[uuid.UUID][]domain.DeviceKey, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		if _, ok := i.devices[deviceID]; !ok {
+			continue
+		}
+
+		keys[deviceID] = make([]domain.DeviceKey, len(i.keys[deviceID]))
+		copy(keys[deviceID], i.keys[deviceID])
+	}
+
+	return keys, nil
+}
+
+func (i *InMemoryRepository) StatusHistory(deviceID uuid.UUID) ([]domain.StatusTransition, error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	if _, ok := i.devices[deviceID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	history := make([]domain.StatusTransition, len(i.history[deviceID]))
+	copy(history, i.history[deviceID])
+
+	return history, nil
+}
+
+func (i *InMemoryRepository) SignTransaction(deviceID uuid.UUID, sign SignFunc) error {
+	i.rw.RLock()
+	device, ok := i.devices[deviceID]
+	i.rw.RUnlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	i.rw.RLock()
+	// re-read the device, its status may have changed while waiting for the lock
+	device = i.devices[deviceID]
+	reservation := Reservation{
+		Device:        device.raw(),
+		Counter:       i.counter[deviceID] + 1,
+		LastSignature: i.signature[deviceID],
+	}
+	i.rw.RUnlock()
+
+	entry, err := sign(reservation)
+	if err != nil {
+		return err
+	}
+	entry.Counter = reservation.Counter
+	entry.KeyVersion = reservation.Device.KeyVersion
+
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	i.counter[deviceID] = reservation.Counter
+	i.signature[deviceID] = entry.Signature
+	i.journal[deviceID] = append(i.journal[deviceID], entry)
+
+	return nil
+}
+
+func (i *InMemoryRepository) GetSignatureAndCount(deviceID uuid.UUID) (signature []byte, count int64, err error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
 
 	if signature, ok := i.signature[deviceID]; ok {
 		return signature, i.counter[deviceID], nil
@@ -115,3 +512,96 @@ func (i *InMemoryRepository) GetSignatureAndCount(deviceID uuid.UUID) (signature
 
 	return nil, initCounter, ErrNotFound
 }
+
+func (i *InMemoryRepository) ListSignatures(deviceID uuid.UUID, query domain.JournalQuery) ([]domain.JournalEntry, error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	if _, ok := i.devices[deviceID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	journal := i.journal[deviceID]
+	start := sort.Search(len(journal), func(n int) bool {
+		return journal[n].Counter >= query.From
+	})
+
+	entries := make([]domain.JournalEntry, 0, query.Limit)
+	for _, entry := range journal[start:] {
+		if !query.Contains(entry.Counter) || len(entries) == query.Limit {
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (i *InMemoryRepository) GetSignature(deviceID uuid.UUID, counter int64) (domain.JournalEntry, error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	if _, ok := i.devices[deviceID]; !ok {
+		return domain.JournalEntry{}, ErrNotFound
+	}
+
+	journal := i.journal[deviceID]
+	n := sort.Search(len(journal), func(n int) bool {
+		return journal[n].Counter >= counter
+	})
+	if n == len(journal) || journal[n].Counter != counter {
+		return domain.JournalEntry{}, ErrSignatureNotFound
+	}
+
+	return journal[n], nil
+}
+
+func (i *InMemoryRepository) AddAuditRecord(record domain.AuditRecord) error {
+	i.rw.Lock()
+	defer i.rw.Unlock()
+
+	if _, ok := i.devices[record.DeviceID]; !ok {
+		return ErrNotFound
+	}
+
+	i.audit[record.DeviceID] = append(i.audit[record.DeviceID], record)
+
+	return nil
+}
+
+func (i *InMemoryRepository) AuditTrail(deviceID uuid.UUID) ([]domain.AuditRecord, error) {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+
+	if _, ok := i.devices[deviceID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	trail := make([]domain.AuditRecord, len(i.audit[deviceID]))
+	copy(trail, i.audit[deviceID])
+
+	return trail, nil
+}
+
+func (d deviceKey) raw() domain.DeviceKeyPairRaw {
+	return domain.DeviceKeyPairRaw{
+		Device:     detach(d.Device),
+		PublicKey:  d.pubKey,
+		PrivateKey: d.privateKey,
+	}
+}
+
+// detach copies the label and the chain start of the device, so callers and the repository never share them.
+func detach(device domain.Device) domain.Device {
+	if device.Label != nil {
+		label := *device.Label
+		device.Label = &label
+	}
+	if device.ChainStart != nil {
+		start := *device.ChainStart
+		start.LastSignature = append([]byte(nil), start.LastSignature...)
+		device.ChainStart = &start
+	}
+
+	return device
+}
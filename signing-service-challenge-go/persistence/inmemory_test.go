@@ -0,0 +1,17 @@
+package persistence_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/repotest"
+)
+
+func TestInMemoryRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.Run(t, func(t *testing.T) persistence.DeviceSignatureRepository {
+		return persistence.NewInMemoryRepository(&sync.RWMutex{})
+	})
+}
@@ -0,0 +1,92 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations holds the schema of each SQL dialect as numbered files, e.g. migrations/postgres/0001_create_devices.sql.
+//
+//go:embed migrations
+var migrations embed.FS
+
+// migrate applies the migrations of the dialect that aren't recorded in schema_migrations yet.
+// All of them run in one transaction, so a failed migration leaves the schema unchanged.
+func migrate(ctx context.Context, db *sql.DB, dialect sqlDialect) error {
+	files, err := fs.Glob(migrations, path.Join("migrations", dialect.name, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// replicas starting at the same time wait for each other instead of applying a migration twice
+	if dialect.migrationLock != "" {
+		if _, err = tx.ExecContext(ctx, dialect.migrationLock); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		version, errVersion := strconv.Atoi(strings.SplitN(path.Base(file), "_", 2)[0])
+		if errVersion != nil {
+			return fmt.Errorf("migration %s: invalid version: %w", file, errVersion)
+		}
+		if applied[version] {
+			continue
+		}
+
+		statements, errRead := fs.ReadFile(migrations, file)
+		if errRead != nil {
+			return errRead
+		}
+		if _, err = tx.ExecContext(ctx, string(statements)); err != nil {
+			return fmt.Errorf("migration %s: %w", file, err)
+		}
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO schema_migrations (version) VALUES (%d)", version)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func appliedMigrations(ctx context.Context, tx *sql.Tx) (map[int]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
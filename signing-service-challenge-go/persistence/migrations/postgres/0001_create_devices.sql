@@ -0,0 +1,43 @@
+CREATE TABLE devices (
+    id                 UUID PRIMARY KEY,
+    algorithm          INTEGER     NOT NULL,
+    label              TEXT,
+    signature_encoding INTEGER     NOT NULL,
+    curve              TEXT        NOT NULL,
+    key_size           INTEGER     NOT NULL,
+    key_version        INTEGER     NOT NULL,
+    status             TEXT        NOT NULL,
+    created_at         TIMESTAMPTZ NOT NULL,
+    public_key         BYTEA       NOT NULL,
+    private_key        BYTEA       NOT NULL,
+    -- chain head: the last committed counter, -1 before the first signature
+    signature_counter  BIGINT      NOT NULL DEFAULT -1,
+    last_signature     BYTEA
+);
+
+CREATE INDEX devices_created_at_idx ON devices (created_at, id);
+CREATE INDEX devices_label_idx ON devices ((COALESCE(label, '') COLLATE "C"), id);
+
+CREATE TABLE device_status_transitions (
+    id          BIGSERIAL PRIMARY KEY,
+    device_id   UUID        NOT NULL REFERENCES devices (id),
+    from_status TEXT        NOT NULL,
+    to_status   TEXT        NOT NULL,
+    reason      TEXT        NOT NULL,
+    at          TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX device_status_transitions_device_idx ON device_status_transitions (device_id, id);
+
+-- the journal is append-only, rows are never updated or deleted
+CREATE TABLE signatures (
+    device_id      UUID        NOT NULL REFERENCES devices (id),
+    counter        BIGINT      NOT NULL,
+    raw_data       TEXT        NOT NULL,
+    raw_data_hash  BYTEA       NOT NULL,
+    secured_data   TEXT        NOT NULL,
+    signature      BYTEA       NOT NULL,
+    last_signature TEXT        NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (device_id, counter)
+);
@@ -0,0 +1,2 @@
+-- devices created before key storages existed hold their key in the repository
+ALTER TABLE devices ADD COLUMN key_storage TEXT NOT NULL DEFAULT 'software';
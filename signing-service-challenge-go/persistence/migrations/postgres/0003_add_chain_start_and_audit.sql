@@ -0,0 +1,15 @@
+-- devices migrated from another system continue its chain: counter of the first signature and its link
+ALTER TABLE devices ADD COLUMN chain_start_counter BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN chain_start_signature BYTEA;
+
+-- the audit trail is append-only, rows are never updated or deleted
+CREATE TABLE device_audit (
+    id        BIGSERIAL PRIMARY KEY,
+    device_id UUID        NOT NULL REFERENCES devices (id),
+    action    TEXT        NOT NULL,
+    actor     TEXT        NOT NULL,
+    detail    TEXT        NOT NULL,
+    at        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX device_audit_device_idx ON device_audit (device_id, id);
@@ -0,0 +1,43 @@
+CREATE TABLE devices (
+    id                 TEXT PRIMARY KEY,
+    algorithm          INTEGER   NOT NULL,
+    label              TEXT,
+    signature_encoding INTEGER   NOT NULL,
+    curve              TEXT      NOT NULL,
+    key_size           INTEGER   NOT NULL,
+    key_version        INTEGER   NOT NULL,
+    status             TEXT      NOT NULL,
+    created_at         TIMESTAMP NOT NULL,
+    public_key         BLOB      NOT NULL,
+    private_key        BLOB      NOT NULL,
+    -- chain head: the last committed counter, -1 before the first signature
+    signature_counter  INTEGER   NOT NULL DEFAULT -1,
+    last_signature     BLOB
+);
+
+CREATE INDEX devices_created_at_idx ON devices (created_at, id);
+CREATE INDEX devices_label_idx ON devices (COALESCE(label, ''), id);
+
+CREATE TABLE device_status_transitions (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id   TEXT      NOT NULL REFERENCES devices (id),
+    from_status TEXT      NOT NULL,
+    to_status   TEXT      NOT NULL,
+    reason      TEXT      NOT NULL,
+    at          TIMESTAMP NOT NULL
+);
+
+CREATE INDEX device_status_transitions_device_idx ON device_status_transitions (device_id, id);
+
+-- the journal is append-only, rows are never updated or deleted
+CREATE TABLE signatures (
+    device_id      TEXT      NOT NULL REFERENCES devices (id),
+    counter        INTEGER   NOT NULL,
+    raw_data       TEXT      NOT NULL,
+    raw_data_hash  BLOB      NOT NULL,
+    secured_data   TEXT      NOT NULL,
+    signature      BLOB      NOT NULL,
+    last_signature TEXT      NOT NULL,
+    created_at     TIMESTAMP NOT NULL,
+    PRIMARY KEY (device_id, counter)
+);
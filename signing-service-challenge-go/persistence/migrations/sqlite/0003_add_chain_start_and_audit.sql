@@ -0,0 +1,15 @@
+-- devices migrated from another system continue its chain: counter of the first signature and its link
+ALTER TABLE devices ADD COLUMN chain_start_counter INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN chain_start_signature BLOB;
+
+-- the audit trail is append-only, rows are never updated or deleted
+CREATE TABLE device_audit (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT      NOT NULL REFERENCES devices (id),
+    action    TEXT      NOT NULL,
+    actor     TEXT      NOT NULL,
+    detail    TEXT      NOT NULL,
+    at        TIMESTAMP NOT NULL
+);
+
+CREATE INDEX device_audit_device_idx ON device_audit (device_id, id);
@@ -0,0 +1,15 @@
+-- every key version of a device, the current one is also held by the devices row
+CREATE TABLE device_keys (
+    device_id  TEXT      NOT NULL REFERENCES devices (id),
+    version    INTEGER   NOT NULL,
+    public_key BLOB      NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    retired_at TIMESTAMP,
+    PRIMARY KEY (device_id, version)
+);
+
+INSERT INTO device_keys (device_id, version, public_key, created_at)
+SELECT id, key_version, public_key, created_at FROM devices;
+
+-- signatures created before key rotation existed are signed with the first key
+ALTER TABLE signatures ADD COLUMN key_version INTEGER NOT NULL DEFAULT 1;
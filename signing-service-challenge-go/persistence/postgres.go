@@ -0,0 +1,49 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	// registers the postgres driver of database/sql
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrationLock is the key of the advisory lock held while migrating.
+const postgresMigrationLock = 0x5349474e // "SIGN"
+
+var postgres = sqlDialect{
+	name: "postgres",
+	placeholder: func(n int) string {
+		return fmt.Sprintf("$%d", n)
+	},
+	lockRow:  " FOR UPDATE",
+	labelKey: `COALESCE(label, '') COLLATE "C"`,
+	hasPrefix: func(expr, prefix string) string {
+		return fmt.Sprintf("starts_with(%s, %s)", expr, prefix)
+	},
+	migrationLock: fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", postgresMigrationLock),
+}
+
+// OpenPostgres connects to the PostgreSQL database of the DSN and migrates its schema.
+// Any number of replicas can share the database, SELECT ... FOR UPDATE on the device row
+// serializes the signatures of a device, so its counter stays gapless.
+func OpenPostgres(dsn string, pool PoolConfig) (*SQLRepository, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	pool.apply(db)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err = migrate(context.Background(), db, postgres); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate postgres schema: %w", err)
+	}
+
+	return &SQLRepository{db: db, dialect: postgres}, nil
+}
@@ -0,0 +1,209 @@
+package persistence_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/repotest"
+)
+
+// postgresDSN is the server the PostgreSQL integration tests run against, they are skipped without one
+// unless PostgreSQL is required.
+var postgresDSN string
+
+// postgresRequired tells whether the PostgreSQL integration tests must run. CI runs a PostgreSQL service
+// container and passes it in POSTGRES_TEST_DSN, or sets CI_REQUIRE_POSTGRES where the tests start a cluster
+// with initdb and pg_ctl, see the test-postgres target of the Makefile.
+func postgresRequired() bool {
+	return os.Getenv("POSTGRES_TEST_DSN") != "" || os.Getenv("CI_REQUIRE_POSTGRES") != ""
+}
+
+func TestMain(m *testing.M) {
+	dsn, stop, err := startPostgres()
+	if err != nil {
+		if postgresRequired() {
+			fmt.Fprintln(os.Stderr, "PostgreSQL integration tests can't run:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(os.Stderr, "skipping PostgreSQL integration tests:", err)
+	}
+	postgresDSN = dsn
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// startPostgres returns the server of POSTGRES_TEST_DSN or starts a throwaway cluster with initdb and pg_ctl.
+func startPostgres() (dsn string, stop func(), err error) {
+	stop = func() {}
+	if dsn = os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		return dsn, stop, pingPostgres(dsn)
+	}
+
+	bin, err := postgresBinaries()
+	if err != nil {
+		return "", stop, err
+	}
+	if os.Geteuid() == 0 {
+		return "", stop, errors.New("PostgreSQL doesn't run as root, set POSTGRES_TEST_DSN")
+	}
+
+	dir, err := os.MkdirTemp("", "postgres")
+	if err != nil {
+		return "", stop, err
+	}
+	stop = func() { os.RemoveAll(dir) }
+
+	initdb := exec.Command(filepath.Join(bin, "initdb"), "-D", dir, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-locale")
+	if out, errInit := initdb.CombinedOutput(); errInit != nil {
+		stop()
+		return "", func() {}, fmt.Errorf("initdb: %v: %s", errInit, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		stop()
+		return "", func() {}, err
+	}
+
+	pgctl := filepath.Join(bin, "pg_ctl")
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c max_connections=300 -F", port, dir)
+	start := exec.Command(pgctl, "-D", dir, "-l", filepath.Join(dir, "server.log"), "-o", options, "-w", "start")
+	if out, errStart := start.CombinedOutput(); errStart != nil {
+		stop()
+		return "", func() {}, fmt.Errorf("pg_ctl start: %v: %s", errStart, out)
+	}
+
+	stop = func() {
+		exec.Command(pgctl, "-D", dir, "-m", "immediate", "stop").Run() //nolint:errcheck
+		os.RemoveAll(dir)
+	}
+
+	return fmt.Sprintf("host=127.0.0.1 port=%d user=postgres dbname=postgres sslmode=disable", port), stop, nil
+}
+
+// postgresBinaries finds the directory of initdb and pg_ctl, in PATH or in the Debian install location.
+func postgresBinaries() (string, error) {
+	if pgctl, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(pgctl), nil
+	}
+
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Strings(dirs)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(dirs[i], "initdb")); err == nil {
+			return dirs[i], nil
+		}
+	}
+
+	return "", errors.New("initdb and pg_ctl not found, set POSTGRES_TEST_DSN")
+}
+
+// pingPostgres checks that the server of dsn accepts connections.
+func pingPostgres(dsn string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Ping()
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// newPostgresDatabase creates an empty database for the test and returns its DSN.
+func newPostgresDatabase(t *testing.T) string {
+	t.Helper()
+
+	if postgresDSN == "" {
+		t.Skip("no PostgreSQL server")
+	}
+
+	admin, err := sql.Open("postgres", postgresDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	name := "test_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	if _, err = admin.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db, errOpen := sql.Open("postgres", postgresDSN)
+		if errOpen != nil {
+			return
+		}
+		defer db.Close()
+		db.Exec("DROP DATABASE IF EXISTS " + name) //nolint:errcheck
+	})
+
+	return withDatabase(postgresDSN, name)
+}
+
+// withDatabase points a URL or key=value DSN to another database.
+func withDatabase(dsn, name string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			u.Path = "/" + name
+			return u.String()
+		}
+	}
+
+	return dsn + " dbname=" + name
+}
+
+func openPostgres(t *testing.T, dsn string) *persistence.SQLRepository {
+	t.Helper()
+
+	repo, err := persistence.OpenPostgres(dsn, persistence.PoolConfig{MaxOpenConns: 50, ConnMaxLifetime: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+func TestPostgresRepository(t *testing.T) {
+	t.Parallel()
+
+	if postgresDSN == "" {
+		t.Skip("no PostgreSQL server")
+	}
+
+	repotest.Run(t, func(t *testing.T) persistence.DeviceSignatureRepository {
+		return openPostgres(t, newPostgresDatabase(t))
+	})
+}
+
+func TestPostgresRepository_SignTransaction_Replicas(t *testing.T) {
+	t.Parallel()
+
+	dsn := newPostgresDatabase(t)
+	repotest.SignConcurrently(t, openPostgres(t, dsn), openPostgres(t, dsn))
+}
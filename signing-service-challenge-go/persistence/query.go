@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+// cursor is the position of the last device of a page. The sort order is part of it,
+// so a cursor can't be used to continue a listing with a different order.
+type cursor struct {
+	Sort      domain.DeviceSort `json:"s"`
+	CreatedAt time.Time         `json:"c"`
+	Label     string            `json:"l"`
+	ID        uuid.UUID         `json:"i"`
+}
+
+// EncodeCursor returns the opaque cursor pointing after the device.
+func EncodeCursor(sort domain.DeviceSort, device domain.Device) string {
+	c := cursor{Sort: sort, CreatedAt: device.CreatedAt, Label: label(device), ID: device.ID}
+
+	// a struct of strings, times and UUIDs always marshals
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor created by EncodeCursor for the same sort order.
+func decodeCursor(sort domain.DeviceSort, s string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, domain.ErrInvalidCursor
+	}
+
+	var c cursor
+	if err = json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		return cursor{}, domain.ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// matches reports whether the device passes the filters of the query.
+func matches(query domain.DeviceQuery, device domain.Device) bool {
+	if query.Algorithm != nil && *query.Algorithm != device.Algorithm {
+		return false
+	}
+	if query.Status != "" && query.Status != device.Status {
+		return false
+	}
+	if query.LabelPrefix != "" && !strings.HasPrefix(label(device), query.LabelPrefix) {
+		return false
+	}
+	if !query.CreatedAfter.IsZero() && !device.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+
+	return true
+}
+
+// compare orders two positions by the sort key and the device ID as tie breaker.
+func compare(sort domain.DeviceSort, a, b cursor) int {
+	var res int
+	switch sort {
+	case domain.SortLabelAsc, domain.SortLabelDesc:
+		res = strings.Compare(a.Label, b.Label)
+	default:
+		switch {
+		case a.CreatedAt.Before(b.CreatedAt):
+			res = -1
+		case a.CreatedAt.After(b.CreatedAt):
+			res = 1
+		}
+	}
+
+	if res == 0 {
+		res = bytes.Compare(a.ID[:], b.ID[:])
+	}
+	if strings.HasPrefix(string(sort), "-") {
+		res = -res
+	}
+
+	return res
+}
+
+func position(device domain.Device) cursor {
+	return cursor{CreatedAt: device.CreatedAt, Label: label(device), ID: device.ID}
+}
+
+func label(device domain.Device) string {
+	if device.Label == nil {
+		return ""
+	}
+
+	return *device.Label
+}
@@ -0,0 +1,1125 @@
+// Package repotest is a conformance suite for implementations of persistence.DeviceSignatureRepository.
+package repotest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// Goroutines is the number of concurrent signature transactions the suite runs against a single device.
+const Goroutines = 300
+
+// NewRepository returns an empty repository for the test, it is called once per subtest.
+type NewRepository func(t *testing.T) persistence.DeviceSignatureRepository
+
+var errSign = errors.New("sign failed")
+
+// Run runs the conformance suite against the repositories returned by newRepository.
+// Timestamps are truncated to microseconds, the precision of the SQL backends.
+func Run(t *testing.T, newRepository NewRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo persistence.DeviceSignatureRepository)
+	}{
+		{"SaveDevice", testSaveDevice},
+		{"SaveDevice_Duplicate", testSaveDeviceDuplicate},
+		{"CreateDevice", testCreateDevice},
+		{"NotFound", testNotFound},
+		{"ListDevices", testListDevices},
+		{"UpdateDevice", testUpdateDevice},
+		{"UpdatePrivateKey", testUpdatePrivateKey},
+		{"TransitionDevice", testTransitionDevice},
+		{"GetDeviceState", testGetDeviceState},
+		{"SignTransaction_Chain", testSignTransactionChain},
+		{"SignTransaction_Rollback", testSignTransactionRollback},
+		{"ListSignatures", testListSignatures},
+		{"SignTransaction_Concurrent", testSignTransactionConcurrent},
+		{"SignTransaction_ConcurrentDevices", testSignTransactionConcurrentDevices},
+		{"SignTransaction_ChainStart", testSignTransactionChainStart},
+		{"AuditTrail", testAuditTrail},
+		{"RotateKey", testRotateKey},
+		{"ListDeviceKeys", testListDeviceKeys},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func newDevice(label *string, createdAt time.Time) domain.DeviceKeyPairRaw {
+	return domain.DeviceKeyPairRaw{
+		Device: domain.Device{
+			ID:         uuid.New(),
+			Algorithm:  domain.ECDSA,
+			Label:      label,
+			Encoding:   domain.EncodingP1363,
+			Curve:      domain.CurveP384,
+			KeyVersion: 1,
+			KeyStorage: domain.KeyStorageSoftware,
+			Status:     domain.StatusActive,
+			CreatedAt:  createdAt,
+		},
+		PublicKey:  []byte("public"),
+		PrivateKey: domain.SecretKey("private"),
+	}
+}
+
+func saveDevice(t *testing.T, repo persistence.DeviceSignatureRepository, device domain.DeviceKeyPairRaw) {
+	t.Helper()
+
+	id, err := repo.SaveDevice(&device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != device.ID {
+		t.Fatalf("expected ID %s, got %s", device.ID, id)
+	}
+}
+
+// sign is a SignFunc that links the entry to the reserved chain state.
+func sign(reservation persistence.Reservation) (domain.JournalEntry, error) {
+	return domain.JournalEntry{
+		RawData:       fmt.Sprintf("data-%d", reservation.Counter),
+		RawDataHash:   []byte("hash"),
+		SecuredData:   fmt.Sprintf("secured-%d", reservation.Counter),
+		Signature:     []byte(fmt.Sprintf("signature-%s-%d", reservation.Device.ID, reservation.Counter)),
+		LastSignature: string(reservation.LastSignature),
+		CreatedAt:     now(),
+	}, nil
+}
+
+func failSign(persistence.Reservation) (domain.JournalEntry, error) {
+	return domain.JournalEntry{}, errSign
+}
+
+func equalDevice(a, b domain.Device) bool {
+	labelsEqual := (a.Label == nil) == (b.Label == nil) && (a.Label == nil || *a.Label == *b.Label)
+
+	return labelsEqual && a.ID == b.ID && a.Algorithm == b.Algorithm && a.Encoding == b.Encoding &&
+		a.Curve == b.Curve && a.KeySize == b.KeySize && a.KeyVersion == b.KeyVersion &&
+		a.KeyStorage == b.KeyStorage && a.Status == b.Status && a.CreatedAt.Equal(b.CreatedAt) &&
+		reflect.DeepEqual(a.ChainStart, b.ChainStart)
+}
+
+// assertChain checks that the journal of the device holds exactly the counters 0 to count-1, each linked to its predecessor.
+func assertChain(t *testing.T, repo persistence.DeviceSignatureRepository, deviceID uuid.UUID, count int) {
+	t.Helper()
+
+	entries, err := repo.ListSignatures(deviceID, domain.JournalQuery{Limit: count + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != count {
+		t.Fatalf("expected %d entries, got %d", count, len(entries))
+	}
+
+	lastSignature := ""
+	for n, entry := range entries {
+		if entry.Counter != int64(n) || entry.LastSignature != lastSignature {
+			t.Fatalf("entry %d breaks the chain: counter %d, last signature %q", n, entry.Counter, entry.LastSignature)
+		}
+		lastSignature = string(entry.Signature)
+	}
+
+	signature, counter, err := repo.GetSignatureAndCount(deviceID)
+	if count == 0 {
+		if !errors.Is(err, persistence.ErrNotFound) || counter != -1 || signature != nil {
+			t.Fatalf("expected empty chain head, got %q, %d: %v", signature, counter, err)
+		}
+		return
+	}
+	if err != nil || counter != int64(count-1) || string(signature) != lastSignature {
+		t.Fatalf("unexpected chain head %q, %d: %v", signature, counter, err)
+	}
+}
+
+func testSaveDevice(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	label := "store-1"
+	device := newDevice(&label, now())
+	saveDevice(t, repo, device)
+
+	unlabeled := newDevice(nil, now())
+	unlabeled.Algorithm = domain.RSA
+	unlabeled.Curve = ""
+	unlabeled.KeySize = 2048
+	unlabeled.KeyStorage = domain.KeyStoragePKCS11
+	saveDevice(t, repo, unlabeled)
+
+	for _, want := range []domain.DeviceKeyPairRaw{device, unlabeled} {
+		got, err := repo.GetDevice(want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalDevice(got.Device, want.Device) {
+			t.Fatalf("expected %+v, got %+v", want.Device, got.Device)
+		}
+		if !bytes.Equal(got.PublicKey, want.PublicKey) || !bytes.Equal(got.PrivateKey, want.PrivateKey) {
+			t.Fatal("stored keys differ")
+		}
+	}
+
+	// the stored device is a copy
+	*device.Label = "changed"
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Label != "store-1" {
+		t.Fatalf("expected label store-1, got %s", *got.Label)
+	}
+}
+
+func testSaveDeviceDuplicate(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	label := "original"
+	device := newDevice(&label, now())
+	saveDevice(t, repo, device)
+	if err := repo.SignTransaction(device.ID, sign); err != nil {
+		t.Fatal(err)
+	}
+
+	duplicate := newDevice(nil, now())
+	duplicate.ID = device.ID
+	if _, err := repo.SaveDevice(&duplicate); !errors.Is(err, persistence.ErrAlreadyExists) {
+		t.Fatalf("expected %v, got %v", persistence.ErrAlreadyExists, err)
+	}
+
+	// neither the device nor its chain is reset
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalDevice(got.Device, device.Device) {
+		t.Fatalf("expected %+v, got %+v", device.Device, got.Device)
+	}
+	assertChain(t, repo, device.ID, 1)
+}
+
+func testNotFound(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	unknown := uuid.New()
+
+	assertNotFound := func(name string, err error) {
+		t.Helper()
+
+		if !errors.Is(err, persistence.ErrNotFound) {
+			t.Fatalf("%s: expected %v, got %v", name, persistence.ErrNotFound, err)
+		}
+	}
+
+	_, err := repo.GetDevice(unknown)
+	assertNotFound("GetDevice", err)
+
+	_, err = repo.UpdateDevice(unknown, func(device *domain.Device) error { return nil })
+	assertNotFound("UpdateDevice", err)
+
+	_, err = repo.TransitionDevice(unknown, func(device *domain.Device) (domain.StatusTransition, error) {
+		return device.Transition(domain.StatusSuspended, "test", now())
+	})
+	assertNotFound("TransitionDevice", err)
+
+	err = repo.AddAuditRecord(domain.AuditRecord{DeviceID: unknown, Action: domain.AuditDeviceMigrated, At: now()})
+	assertNotFound("AddAuditRecord", err)
+
+	_, err = repo.AuditTrail(unknown)
+	assertNotFound("AuditTrail", err)
+
+	err = repo.UpdatePrivateKey(unknown, func(privateKey []byte) ([]byte, error) { return privateKey, nil })
+	assertNotFound("UpdatePrivateKey", err)
+
+	_, err = repo.RotateKey(unknown, func(device domain.Device) (persistence.KeyRotation, error) {
+		return persistence.KeyRotation{
+			Key:        domain.DeviceKey{Version: 2, PublicKey: []byte("public"), CreatedAt: now()},
+			PrivateKey: []byte("private"),
+		}, nil
+	})
+	assertNotFound("RotateKey", err)
+
+	_, err = repo.DeviceKeys(unknown)
+	assertNotFound("DeviceKeys", err)
+
+	_, err = repo.StatusHistory(unknown)
+	assertNotFound("StatusHistory", err)
+
+	_, err = repo.GetDeviceState(unknown)
+	assertNotFound("GetDeviceState", err)
+
+	called := false
+	err = repo.SignTransaction(unknown, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+		called = true
+		return sign(reservation)
+	})
+	assertNotFound("SignTransaction", err)
+	if called {
+		t.Fatal("sign called for an unknown device")
+	}
+
+	_, count, err := repo.GetSignatureAndCount(unknown)
+	assertNotFound("GetSignatureAndCount", err)
+	if count != -1 {
+		t.Fatalf("expected count -1, got %d", count)
+	}
+
+	_, err = repo.ListSignatures(unknown, domain.JournalQuery{Limit: 10})
+	assertNotFound("ListSignatures", err)
+
+	_, err = repo.GetSignature(unknown, 0)
+	assertNotFound("GetSignature", err)
+
+	// a known device without the counter
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	_, err = repo.GetSignature(device.ID, 0)
+	if !errors.Is(err, persistence.ErrSignatureNotFound) {
+		t.Fatalf("expected %v, got %v", persistence.ErrSignatureNotFound, err)
+	}
+
+	entries, err := repo.ListSignatures(device.ID, domain.JournalQuery{Limit: 10})
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty journal, got %d entries: %v", len(entries), err)
+	}
+}
+
+func testListDevices(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	base := now().Add(-time.Hour)
+	labels := []string{"store-b", "store-a", "till-1", "store-a", ""}
+
+	var devices []domain.Device
+	for n, l := range labels {
+		var label *string
+		if l != "" {
+			l := l
+			label = &l
+		}
+
+		// the last two devices share the creation time, so their order depends on the ID
+		createdAt := base.Add(time.Duration(n) * time.Minute)
+		if n == len(labels)-1 {
+			createdAt = devices[n-1].CreatedAt
+		}
+
+		device := newDevice(label, createdAt)
+		if n == 2 {
+			device.Algorithm = domain.RSA
+			device.Status = domain.StatusSuspended
+		}
+		saveDevice(t, repo, device)
+		devices = append(devices, device.Device)
+	}
+
+	rsa := domain.RSA
+	queries := []domain.DeviceQuery{
+		{},
+		{Algorithm: &rsa},
+		{Status: domain.StatusActive},
+		{LabelPrefix: "store-"},
+		{CreatedAfter: devices[1].CreatedAt},
+	}
+	sorts := []domain.DeviceSort{domain.SortCreatedAtAsc, domain.SortCreatedAtDesc, domain.SortLabelAsc, domain.SortLabelDesc}
+
+	for _, query := range queries {
+		for _, order := range sorts {
+			query.Sort = order
+			query.Limit = 2
+			query.Cursor = ""
+
+			var want []uuid.UUID
+			for _, device := range sortDevices(order, devices) {
+				if matches(query, device) {
+					want = append(want, device.ID)
+				}
+			}
+
+			var got []uuid.UUID
+			for page := 0; ; page++ {
+				if page > len(devices) {
+					t.Fatalf("listing %+v doesn't end", query)
+				}
+
+				result, next, err := repo.ListDevices(query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(result) > query.Limit {
+					t.Fatalf("expected at most %d devices, got %d", query.Limit, len(result))
+				}
+				for _, device := range result {
+					got = append(got, device.ID)
+				}
+
+				if next == "" {
+					break
+				}
+				query.Cursor = next
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("query %+v: expected %v, got %v", query, want, got)
+			}
+		}
+	}
+
+	_, _, err := repo.ListDevices(domain.DeviceQuery{Sort: domain.SortLabelAsc, Cursor: "invalid", Limit: 2})
+	if !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Fatalf("expected %v, got %v", domain.ErrInvalidCursor, err)
+	}
+}
+
+// sortDevices orders the devices by the sort key with the ID bytes as tie breaker.
+func sortDevices(order domain.DeviceSort, devices []domain.Device) []domain.Device {
+	sorted := append([]domain.Device(nil), devices...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+
+		var res int
+		if order == domain.SortLabelAsc || order == domain.SortLabelDesc {
+			res = strings.Compare(labelOf(a), labelOf(b))
+		} else if !a.CreatedAt.Equal(b.CreatedAt) {
+			res = 1
+			if a.CreatedAt.Before(b.CreatedAt) {
+				res = -1
+			}
+		}
+		if res == 0 {
+			res = bytes.Compare(a.ID[:], b.ID[:])
+		}
+		if strings.HasPrefix(string(order), "-") {
+			res = -res
+		}
+
+		return res < 0
+	})
+
+	return sorted
+}
+
+func matches(query domain.DeviceQuery, device domain.Device) bool {
+	return (query.Algorithm == nil || *query.Algorithm == device.Algorithm) &&
+		(query.Status == "" || query.Status == device.Status) &&
+		strings.HasPrefix(labelOf(device), query.LabelPrefix) &&
+		(query.CreatedAfter.IsZero() || device.CreatedAt.After(query.CreatedAfter))
+}
+
+func labelOf(device domain.Device) string {
+	if device.Label == nil {
+		return ""
+	}
+
+	return *device.Label
+}
+
+func testUpdateDevice(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	label := "renamed"
+	updated, err := repo.UpdateDevice(device.ID, func(d *domain.Device) error {
+		d.Label = &label
+		// neither the ID, the key storage nor the status can be changed by an update
+		d.ID = uuid.New()
+		d.KeyStorage = domain.KeyStoragePKCS11
+		d.Status = domain.StatusDecommissioned
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != device.ID || updated.KeyStorage != device.KeyStorage || updated.Status != device.Status ||
+		updated.Label == nil || *updated.Label != label {
+		t.Fatalf("unexpected update %+v", updated)
+	}
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalDevice(got.Device, updated) {
+		t.Fatalf("expected %+v, got %+v", updated, got.Device)
+	}
+
+	// a failing update leaves the device unchanged
+	errUpdate := errors.New("update failed")
+	_, err = repo.UpdateDevice(device.ID, func(d *domain.Device) error {
+		d.Label = nil
+		return errUpdate
+	})
+	if !errors.Is(err, errUpdate) {
+		t.Fatalf("expected %v, got %v", errUpdate, err)
+	}
+
+	got, err = repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalDevice(got.Device, updated) {
+		t.Fatalf("expected %+v, got %+v", updated, got.Device)
+	}
+	// the listing follows the new label
+	other := "relabel-b"
+	otherDevice := newDevice(&other, now())
+	saveDevice(t, repo, otherDevice)
+	label = "relabel-c"
+	if _, err = repo.UpdateDevice(device.ID, func(d *domain.Device) error {
+		d.Label = &label
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range []domain.DeviceSort{domain.SortLabelAsc, domain.SortLabelDesc} {
+		query := domain.DeviceQuery{LabelPrefix: "relabel-", Sort: order, Limit: 1}
+		query.Normalize()
+
+		var listed []uuid.UUID
+		for {
+			devices, next, errList := repo.ListDevices(query)
+			if errList != nil {
+				t.Fatal(errList)
+			}
+			for _, d := range devices {
+				listed = append(listed, d.ID)
+			}
+			if next == "" {
+				break
+			}
+			query.Cursor = next
+		}
+
+		expected := []uuid.UUID{otherDevice.ID, device.ID}
+		if order == domain.SortLabelDesc {
+			expected = []uuid.UUID{device.ID, otherDevice.ID}
+		}
+		if !reflect.DeepEqual(listed, expected) {
+			t.Fatalf("%s: expected %v, got %v", order, expected, listed)
+		}
+	}
+}
+
+func testUpdatePrivateKey(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	err := repo.UpdatePrivateKey(device.ID, func(privateKey []byte) ([]byte, error) {
+		if !bytes.Equal(privateKey, device.PrivateKey) {
+			t.Errorf("expected the stored private key, got %d bytes", len(privateKey))
+		}
+		return []byte("rewrapped"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failing update keeps the key
+	errUpdate := errors.New("update failed")
+	err = repo.UpdatePrivateKey(device.ID, func([]byte) ([]byte, error) { return []byte("lost"), errUpdate })
+	if !errors.Is(err, errUpdate) {
+		t.Fatalf("expected %v, got %v", errUpdate, err)
+	}
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.PrivateKey) != "rewrapped" || !bytes.Equal(got.PublicKey, device.PublicKey) ||
+		!equalDevice(got.Device, device.Device) {
+		t.Fatalf("unexpected device %+v after the key update", got.Device)
+	}
+
+	err = repo.SignTransaction(device.ID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+		if string(reservation.Device.PrivateKey) != "rewrapped" {
+			t.Error("reservation without the updated key")
+		}
+		return sign(reservation)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCreateDevice(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	activation := domain.StatusTransition{
+		From:   domain.StatusInitialized,
+		To:     domain.StatusActive,
+		Reason: "activated on creation",
+		At:     device.CreatedAt,
+	}
+
+	audit := domain.AuditRecord{
+		DeviceID: device.ID,
+		Action:   domain.AuditDeviceMigrated,
+		Actor:    "operator",
+		Detail:   "created",
+		At:       device.CreatedAt,
+	}
+
+	id, err := repo.CreateDevice(persistence.DeviceCreation{
+		Device:  &device,
+		History: []domain.StatusTransition{activation},
+		Audit:   []domain.AuditRecord{audit},
+	})
+	if err != nil || id != device.ID {
+		t.Fatalf("expected ID %s, got %s: %v", device.ID, id, err)
+	}
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil || !equalDevice(got.Device, device.Device) {
+		t.Fatalf("expected %+v, got %+v: %v", device.Device, got.Device, err)
+	}
+
+	history, err := repo.StatusHistory(device.ID)
+	if err != nil || len(history) != 1 || history[0] != activation {
+		t.Fatalf("expected history %+v, got %+v: %v", activation, history, err)
+	}
+
+	trail, err := repo.AuditTrail(device.ID)
+	if err != nil || len(trail) != 1 || trail[0] != audit {
+		t.Fatalf("expected audit trail %+v, got %+v: %v", audit, trail, err)
+	}
+
+	// a rejected device keeps the records of the stored one
+	_, err = repo.CreateDevice(persistence.DeviceCreation{Device: &device, History: []domain.StatusTransition{activation}})
+	if !errors.Is(err, persistence.ErrAlreadyExists) {
+		t.Fatalf("expected %v, got %v", persistence.ErrAlreadyExists, err)
+	}
+
+	history, err = repo.StatusHistory(device.ID)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("expected a single transition, got %+v: %v", history, err)
+	}
+}
+
+func testTransitionDevice(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	device.Status = domain.StatusInitialized
+	saveDevice(t, repo, device)
+
+	history, err := repo.StatusHistory(device.ID)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("expected empty history, got %+v: %v", history, err)
+	}
+
+	// the label changes in the same transaction as the status
+	label := "transitioned"
+	for _, to := range []domain.DeviceStatus{domain.StatusActive, domain.StatusSuspended} {
+		updated, errTransition := repo.TransitionDevice(device.ID, func(d *domain.Device) (domain.StatusTransition, error) {
+			d.Label = &label
+			return d.Transition(to, "to "+string(to), now())
+		})
+		if errTransition != nil || updated.Status != to {
+			t.Fatalf("unexpected transition %+v: %v", updated, errTransition)
+		}
+	}
+
+	// the transition is rejected, so neither the status nor the history changes
+	_, err = repo.TransitionDevice(device.ID, func(d *domain.Device) (domain.StatusTransition, error) {
+		return d.Transition(domain.StatusInitialized, "back", now())
+	})
+	if !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Fatalf("expected %v, got %v", domain.ErrInvalidTransition, err)
+	}
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil || got.Status != domain.StatusSuspended || got.Label == nil || *got.Label != label {
+		t.Fatalf("expected status %s and label %s, got %+v: %v", domain.StatusSuspended, label, got.Device, err)
+	}
+
+	page, _, err := repo.ListDevices(domain.DeviceQuery{Status: domain.StatusSuspended, LabelPrefix: label,
+		Sort: domain.SortLabelAsc, Limit: 10})
+	if err != nil || len(page) != 1 || page[0].ID != device.ID {
+		t.Fatalf("expected the transitioned device to be listed, got %+v: %v", page, err)
+	}
+
+	history, err = repo.StatusHistory(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 ||
+		history[0].From != domain.StatusInitialized || history[0].To != domain.StatusActive ||
+		history[1].From != domain.StatusActive || history[1].To != domain.StatusSuspended ||
+		history[1].Reason != "to suspended" || history[1].At.IsZero() {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// the reservation carries the current status
+	err = repo.SignTransaction(device.ID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+		if reservation.Device.Status != domain.StatusSuspended {
+			t.Errorf("expected reserved status %s, got %s", domain.StatusSuspended, reservation.Device.Status)
+		}
+		return domain.JournalEntry{}, errSign
+	})
+	if !errors.Is(err, errSign) {
+		t.Fatalf("expected %v, got %v", errSign, err)
+	}
+}
+
+func testGetDeviceState(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	state, err := repo.GetDeviceState(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalDevice(state.Device.Device, device.Device) || !bytes.Equal(state.Device.PublicKey, device.PublicKey) ||
+		state.Counter != -1 || state.LastSignature != nil || len(state.History) != 0 {
+		t.Fatalf("unexpected state of a new device %+v", state)
+	}
+
+	// the chain head always belongs to the counter, however the reads and signatures interleave
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for n := 0; n < 20; n++ {
+			if errSign := repo.SignTransaction(device.ID, sign); errSign != nil {
+				t.Error(errSign)
+				return
+			}
+		}
+	}()
+	for n := 0; n < 20; n++ {
+		state, err = repo.GetDeviceState(device.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf("signature-%s-%d", device.ID, state.Counter)
+		if state.Counter >= 0 && string(state.LastSignature) != expected {
+			t.Fatalf("expected the last signature %s, got %s", expected, state.LastSignature)
+		}
+	}
+	wg.Wait()
+
+	_, err = repo.TransitionDevice(device.ID, func(d *domain.Device) (domain.StatusTransition, error) {
+		return d.Transition(domain.StatusSuspended, "audit", now())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = repo.GetDeviceState(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Device.Status != domain.StatusSuspended || state.Counter != 19 ||
+		string(state.LastSignature) != fmt.Sprintf("signature-%s-19", device.ID) ||
+		len(state.History) != 1 || state.History[0].To != domain.StatusSuspended {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func testSignTransactionChain(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+	assertChain(t, repo, device.ID, 0)
+
+	var lastSignature []byte
+	for n := int64(0); n < 5; n++ {
+		var entry domain.JournalEntry
+		err := repo.SignTransaction(device.ID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+			if reservation.Counter != n || !bytes.Equal(reservation.LastSignature, lastSignature) {
+				t.Errorf("unexpected reservation %d, %q", reservation.Counter, reservation.LastSignature)
+			}
+			if reservation.Device.ID != device.ID || !bytes.Equal(reservation.Device.PrivateKey, device.PrivateKey) {
+				t.Error("reservation without the device key")
+			}
+
+			var err error
+			entry, err = sign(reservation)
+			// the repository assigns the reserved counter
+			entry.Counter = 42
+			return entry, err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.GetSignature(device.ID, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Counter != n || got.RawData != entry.RawData || !bytes.Equal(got.RawDataHash, entry.RawDataHash) ||
+			got.SecuredData != entry.SecuredData || !bytes.Equal(got.Signature, entry.Signature) ||
+			got.LastSignature != entry.LastSignature || !got.CreatedAt.Equal(entry.CreatedAt) {
+			t.Fatalf("expected %+v, got %+v", entry, got)
+		}
+
+		lastSignature = entry.Signature
+	}
+
+	assertChain(t, repo, device.ID, 5)
+}
+
+func testSignTransactionRollback(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	if err := repo.SignTransaction(device.ID, failSign); !errors.Is(err, errSign) {
+		t.Fatalf("expected %v, got %v", errSign, err)
+	}
+	assertChain(t, repo, device.ID, 0)
+
+	if err := repo.SignTransaction(device.ID, sign); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SignTransaction(device.ID, failSign); !errors.Is(err, errSign) {
+		t.Fatalf("expected %v, got %v", errSign, err)
+	}
+	if err := repo.SignTransaction(device.ID, sign); err != nil {
+		t.Fatal(err)
+	}
+	assertChain(t, repo, device.ID, 2)
+}
+
+func testListSignatures(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+	for n := 0; n < 10; n++ {
+		if err := repo.SignTransaction(device.ID, sign); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to := int64(7)
+	tests := []struct {
+		query domain.JournalQuery
+		want  []int64
+	}{
+		{domain.JournalQuery{From: 0, Limit: 3}, []int64{0, 1, 2}},
+		{domain.JournalQuery{From: 8, Limit: 5}, []int64{8, 9}},
+		{domain.JournalQuery{From: 3, To: &to, Limit: 3}, []int64{3, 4, 5}},
+		{domain.JournalQuery{From: 6, To: &to, Limit: 3}, []int64{6, 7}},
+		{domain.JournalQuery{From: 10, Limit: 3}, nil},
+	}
+
+	for _, tt := range tests {
+		entries, err := repo.ListSignatures(device.ID, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []int64
+		for _, entry := range entries {
+			got = append(got, entry.Counter)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Fatalf("query %+v: expected %v, got %v", tt.query, tt.want, got)
+		}
+	}
+
+	if _, err := repo.GetSignature(device.ID, 10); !errors.Is(err, persistence.ErrSignatureNotFound) {
+		t.Fatalf("expected %v, got %v", persistence.ErrSignatureNotFound, err)
+	}
+}
+
+func testSignTransactionConcurrent(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	SignConcurrently(t, repo)
+}
+
+// SignConcurrently signs with a single device from Goroutines goroutines, every tenth signature fails.
+// The goroutines take turns on the replicas, which share one database, so the counters must stay gapless
+// across all of them.
+func SignConcurrently(t *testing.T, replicas ...persistence.DeviceSignatureRepository) {
+	t.Helper()
+
+	device := newDevice(nil, now())
+	saveDevice(t, replicas[0], device)
+
+	var mu sync.Mutex
+	reserved := make(map[int64]int)
+
+	var wg sync.WaitGroup
+	for n := 0; n < Goroutines; n++ {
+		wg.Add(1)
+		go func(repo persistence.DeviceSignatureRepository, fail bool) {
+			defer wg.Done()
+
+			err := repo.SignTransaction(device.ID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+				if fail {
+					return failSign(reservation)
+				}
+
+				mu.Lock()
+				reserved[reservation.Counter]++
+				mu.Unlock()
+
+				return sign(reservation)
+			})
+			if (fail && !errors.Is(err, errSign)) || (!fail && err != nil) {
+				t.Error(err)
+			}
+		}(replicas[n%len(replicas)], n%10 == 0)
+	}
+	wg.Wait()
+
+	want := Goroutines - Goroutines/10
+	for counter, n := range reserved {
+		if n != 1 {
+			t.Fatalf("counter %d committed %d times", counter, n)
+		}
+	}
+	for _, repo := range replicas {
+		assertChain(t, repo, device.ID, want)
+	}
+}
+
+// testSignTransactionConcurrentDevices interleaves the signatures of several devices, their chains are independent.
+func testSignTransactionConcurrentDevices(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	const (
+		devices    = 4
+		signatures = Goroutines / devices
+	)
+
+	ids := make([]uuid.UUID, devices)
+	for n := range ids {
+		device := newDevice(nil, now())
+		saveDevice(t, repo, device)
+		ids[n] = device.ID
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < devices*signatures; n++ {
+		wg.Add(1)
+		go func(deviceID uuid.UUID) {
+			defer wg.Done()
+
+			if err := repo.SignTransaction(deviceID, sign); err != nil {
+				t.Error(err)
+			}
+		}(ids[n%devices])
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		assertChain(t, repo, id, signatures)
+	}
+}
+
+func testSignTransactionChainStart(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	device.ChainStart = &domain.ChainStart{Counter: 1000, LastSignature: []byte("signature-999")}
+	saveDevice(t, repo, device)
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalDevice(got.Device, device.Device) {
+		t.Fatalf("expected %+v, got %+v", device.Device, got.Device)
+	}
+
+	// the chain starts at the counter of the migrated device, linked to its last signature
+	signature, counter, err := repo.GetSignatureAndCount(device.ID)
+	if err != nil || counter != 999 || string(signature) != "signature-999" {
+		t.Fatalf("unexpected chain head %q, %d: %v", signature, counter, err)
+	}
+
+	lastSignature := []byte("signature-999")
+	for n := int64(1000); n < 1003; n++ {
+		err = repo.SignTransaction(device.ID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+			if reservation.Counter != n || !bytes.Equal(reservation.LastSignature, lastSignature) {
+				t.Errorf("unexpected reservation %d, %q", reservation.Counter, reservation.LastSignature)
+			}
+			entry, errSign := sign(reservation)
+			lastSignature = entry.Signature
+
+			return entry, errSign
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := repo.ListSignatures(device.ID, domain.JournalQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Counter != 1000 || entries[2].Counter != 1002 {
+		t.Fatalf("expected counters 1000 to 1002, got %+v", entries)
+	}
+}
+
+func testAuditTrail(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	trail, err := repo.AuditTrail(device.ID)
+	if err != nil || len(trail) != 0 {
+		t.Fatalf("expected an empty audit trail, got %+v: %v", trail, err)
+	}
+
+	records := []domain.AuditRecord{
+		{DeviceID: device.ID, Action: domain.AuditDeviceMigrated, Actor: "admin", Detail: "first", At: now()},
+		{DeviceID: device.ID, Action: domain.AuditDeviceMigrated, Actor: "admin", Detail: "second", At: now().Add(time.Second)},
+	}
+	for _, record := range records {
+		if err = repo.AddAuditRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trail, err = repo.AuditTrail(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(trail))
+	}
+	for n, record := range records {
+		got := trail[n]
+		if got.DeviceID != record.DeviceID || got.Action != record.Action || got.Actor != record.Actor ||
+			got.Detail != record.Detail || !got.At.Equal(record.At) {
+			t.Fatalf("expected %+v, got %+v", record, got)
+		}
+	}
+}
+
+func testRotateKey(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	device := newDevice(nil, now())
+	saveDevice(t, repo, device)
+
+	if err := repo.SignTransaction(device.ID, sign); err != nil {
+		t.Fatal(err)
+	}
+
+	rotatedAt := now().Add(time.Second)
+	audit := domain.AuditRecord{DeviceID: device.ID, Action: domain.AuditKeyRotated, Actor: "admin", Detail: "rotated", At: rotatedAt}
+	rotated, err := repo.RotateKey(device.ID, func(d domain.Device) (persistence.KeyRotation, error) {
+		if d.KeyVersion != 1 {
+			t.Errorf("expected key version 1, got %d", d.KeyVersion)
+		}
+		return persistence.KeyRotation{
+			Key:        domain.DeviceKey{Version: 2, PublicKey: []byte("public-2"), CreatedAt: rotatedAt},
+			PrivateKey: []byte("private-2"),
+			Audit:      []domain.AuditRecord{audit},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.KeyVersion != 2 {
+		t.Fatalf("expected key version 2, got %d", rotated.KeyVersion)
+	}
+
+	// a failing rotation keeps the key
+	errRotate := errors.New("rotation failed")
+	_, err = repo.RotateKey(device.ID, func(domain.Device) (persistence.KeyRotation, error) {
+		return persistence.KeyRotation{}, errRotate
+	})
+	if !errors.Is(err, errRotate) {
+		t.Fatalf("expected %v, got %v", errRotate, err)
+	}
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.KeyVersion != 2 || string(got.PublicKey) != "public-2" || string(got.PrivateKey) != "private-2" {
+		t.Fatalf("unexpected device %+v after the rotation", got.Device)
+	}
+
+	keys, err := repo.DeviceKeys(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 key versions, got %d", len(keys))
+	}
+	if keys[0].Version != 1 || string(keys[0].PublicKey) != "public" || !keys[0].CreatedAt.Equal(device.CreatedAt) ||
+		keys[0].RetiredAt == nil || !keys[0].RetiredAt.Equal(rotatedAt) {
+		t.Fatalf("unexpected retired key %+v", keys[0])
+	}
+	if keys[1].Version != 2 || string(keys[1].PublicKey) != "public-2" || keys[1].RetiredAt != nil {
+		t.Fatalf("unexpected current key %+v", keys[1])
+	}
+
+	// the audit record is stored with the rotation, the failed one left none
+	trail, err := repo.AuditTrail(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 1 || trail[0].Action != audit.Action || trail[0].Actor != audit.Actor ||
+		trail[0].Detail != audit.Detail || !trail[0].At.Equal(audit.At) {
+		t.Fatalf("expected the audit record %+v, got %+v", audit, trail)
+	}
+
+	// the chain continues across the rotation, each entry records the key version that signed it
+	if err = repo.SignTransaction(device.ID, sign); err != nil {
+		t.Fatal(err)
+	}
+	assertChain(t, repo, device.ID, 2)
+
+	entries, err := repo.ListSignatures(device.ID, domain.JournalQuery{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].KeyVersion != 1 || entries[1].KeyVersion != 2 {
+		t.Fatalf("expected key versions 1 and 2, got %d and %d", entries[0].KeyVersion, entries[1].KeyVersion)
+	}
+}
+
+func testListDeviceKeys(t *testing.T, repo persistence.DeviceSignatureRepository) {
+	rotated, single := newDevice(nil, now()), newDevice(nil, now())
+	saveDevice(t, repo, rotated)
+	saveDevice(t, repo, single)
+
+	_, err := repo.RotateKey(rotated.ID, func(domain.Device) (persistence.KeyRotation, error) {
+		return persistence.KeyRotation{
+			Key:        domain.DeviceKey{Version: 2, PublicKey: []byte("public-2"), CreatedAt: now().Add(time.Second)},
+			PrivateKey: []byte("private-2"),
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := repo.ListDeviceKeys([]uuid.UUID{rotated.ID, single.ID, uuid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected the keys of 2 devices, got %d", len(keys))
+	}
+	for _, device := range []domain.DeviceKeyPairRaw{rotated, single} {
+		want, errKeys := repo.DeviceKeys(device.ID)
+		if errKeys != nil {
+			t.Fatal(errKeys)
+		}
+		got := keys[device.ID]
+		if len(got) != len(want) {
+			t.Fatalf("expected %d key versions of device %s, got %d", len(want), device.ID, len(got))
+		}
+		for n := range want {
+			if got[n].Version != want[n].Version || string(got[n].PublicKey) != string(want[n].PublicKey) ||
+				!got[n].CreatedAt.Equal(want[n].CreatedAt) || (got[n].RetiredAt == nil) != (want[n].RetiredAt == nil) {
+				t.Fatalf("expected key %+v, got %+v", want[n], got[n])
+			}
+		}
+	}
+
+	keys, err = repo.ListDeviceKeys(nil)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys, got %v: %v", keys, err)
+	}
+}
@@ -0,0 +1,799 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+)
+
+const deviceColumns = `id, algorithm, label, signature_encoding, curve, key_size, key_version, key_storage, status, created_at, public_key, private_key,
+	chain_start_counter, chain_start_signature`
+
+const signatureColumns = `counter, raw_data, raw_data_hash, secured_data, signature, last_signature, key_version, created_at`
+
+// sqlDialect holds what differs between the SQL databases behind SQLRepository.
+type sqlDialect struct {
+	// name is the directory of the migrations of the dialect.
+	name string
+	// placeholder returns the bind parameter n, counting from 1.
+	placeholder func(n int) string
+	// lockRow is appended to the select of a device row that the transaction changes.
+	lockRow string
+	// labelKey orders labels byte by byte like the in-memory repository, a missing label sorts as "".
+	labelKey string
+	// hasPrefix returns the condition that expr starts with the bind parameter prefix.
+	hasPrefix func(expr, prefix string) string
+	// migrationLock serializes the migrations of concurrently starting replicas.
+	migrationLock string
+	// lockWrite is the first statement of every transaction where the database can't lock rows,
+	// it takes the write lock up front.
+	lockWrite string
+}
+
+// PoolConfig configures the connection pool of a SQL repository, zero values keep the database/sql defaults.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (c PoolConfig) apply(db *sql.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
+// SQLRepository stores devices and their signature journal in a SQL database.
+// Every change of a device locks its row, so counters stay gapless across replicas sharing the database.
+type SQLRepository struct {
+	db      *sql.DB
+	dialect sqlDialect
+
+	// writer serializes the writes of the process when the database can't lock rows, nil otherwise.
+	writer *sync.Mutex
+}
+
+// Close closes the connection pool.
+func (r *SQLRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *SQLRepository) SaveDevice(device *domain.DeviceKeyPairRaw) (uuid.UUID, error) {
+	return r.CreateDevice(DeviceCreation{Device: device})
+}
+
+func (r *SQLRepository) CreateDevice(creation DeviceCreation) (uuid.UUID, error) {
+	device := creation.Device
+	// a resumed chain continues after the last signature of the migrated device
+	startCounter, startSignature := device.ChainOrigin()
+
+	err := r.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(fmt.Sprintf(`INSERT INTO devices (%s, signature_counter, last_signature) VALUES (%s)
+			ON CONFLICT (id) DO NOTHING`, deviceColumns, r.placeholders(1, 16)),
+			device.ID, int(device.Algorithm), device.Label, int(device.Encoding), string(device.Curve), device.KeySize,
+			device.KeyVersion, string(device.KeyStorage), string(device.Status), device.CreatedAt.UTC(), blob(device.PublicKey),
+			blob(device.PrivateKey), startCounter, startSignature, startCounter-1, startSignature,
+		)
+		if err != nil {
+			return err
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if inserted == 0 {
+			return ErrAlreadyExists
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`INSERT INTO device_keys (device_id, version, public_key, created_at) VALUES (%s)`,
+			r.placeholders(1, 4)),
+			device.ID, device.KeyVersion, blob(device.PublicKey), device.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range creation.History {
+			if err = r.insertTransition(tx, device.ID, record); err != nil {
+				return err
+			}
+		}
+		for _, record := range creation.Audit {
+			if err = r.insertAuditRecord(tx, record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return device.ID, nil
+}
+
+func (r *SQLRepository) GetDevice(deviceID uuid.UUID) (domain.DeviceKeyPairRaw, error) {
+	row := r.db.QueryRow(fmt.Sprintf(`SELECT %s FROM devices WHERE id = %s`, deviceColumns, r.dialect.placeholder(1)), deviceID)
+
+	return scanDevice(row)
+}
+
+func (r *SQLRepository) GetDeviceState(deviceID uuid.UUID) (DeviceState, error) {
+	var state DeviceState
+
+	err := r.readTx(func(tx *sql.Tx) error {
+		device, err := scanDevice(tx.QueryRow(fmt.Sprintf(`SELECT %s, signature_counter, last_signature FROM devices WHERE id = %s`,
+			deviceColumns, r.dialect.placeholder(1)), deviceID), &state.Counter, &state.LastSignature)
+		if err != nil {
+			return err
+		}
+		state.Device = device
+		if state.Counter == initCounter {
+			state.LastSignature = nil
+		}
+
+		state.History, err = r.statusHistory(tx, deviceID)
+
+		return err
+	})
+	if err != nil {
+		return DeviceState{}, err
+	}
+
+	return state, nil
+}
+
+func (r *SQLRepository) ListDevices(query domain.DeviceQuery) ([]domain.DeviceKeyPairRaw, string, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return r.dialect.placeholder(len(args))
+	}
+
+	if query.Algorithm != nil {
+		conditions = append(conditions, "algorithm = "+arg(int(*query.Algorithm)))
+	}
+	if query.Status != "" {
+		conditions = append(conditions, "status = "+arg(string(query.Status)))
+	}
+	if query.LabelPrefix != "" {
+		conditions = append(conditions, r.dialect.hasPrefix("COALESCE(label, '')", arg(query.LabelPrefix)))
+	}
+	if !query.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at > "+arg(query.CreatedAfter.UTC()))
+	}
+
+	key, direction, after := "created_at", "ASC", ">"
+	if query.Sort == domain.SortLabelAsc || query.Sort == domain.SortLabelDesc {
+		key = r.dialect.labelKey
+	}
+	if strings.HasPrefix(string(query.Sort), "-") {
+		direction, after = "DESC", "<"
+	}
+
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Sort, query.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		var position interface{} = c.CreatedAt.UTC()
+		if key == r.dialect.labelKey {
+			position = c.Label
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", key, after, arg(position), arg(c.ID)))
+	}
+
+	statement := fmt.Sprintf(`SELECT %s FROM devices`, deviceColumns)
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// one more device than requested tells whether there is a next page
+	statement += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %s", key, direction, direction, arg(query.Limit+1))
+
+	rows, err := r.db.Query(statement, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	devices := make([]domain.DeviceKeyPairRaw, 0, query.Limit+1)
+	for rows.Next() {
+		device, errScan := scanDevice(rows)
+		if errScan != nil {
+			return nil, "", errScan
+		}
+		devices = append(devices, device)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(devices) <= query.Limit {
+		return devices, "", nil
+	}
+
+	devices = devices[:query.Limit]
+
+	return devices, EncodeCursor(query.Sort, devices[len(devices)-1].Device), nil
+}
+
+func (r *SQLRepository) UpdateDevice(deviceID uuid.UUID, update func(device *domain.Device) error) (domain.Device, error) {
+	var updated domain.Device
+
+	err := r.inTx(func(tx *sql.Tx) error {
+		device, err := r.lockDevice(tx, deviceID)
+		if err != nil {
+			return err
+		}
+
+		updated = device.Device
+		if err = update(&updated); err != nil {
+			return err
+		}
+		// the identity and the key of a device never change through an update, its status only through a transition
+		updated.ID = device.ID
+		updated.KeyVersion = device.KeyVersion
+		updated.KeyStorage = device.KeyStorage
+		updated.Status = device.Status
+		updated.ChainStart = device.ChainStart
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE devices SET algorithm = %s, label = %s, signature_encoding = %s, curve = %s,
+			key_size = %s, key_version = %s, created_at = %s WHERE id = %s`, r.bind(8)...),
+			int(updated.Algorithm), updated.Label, int(updated.Encoding), string(updated.Curve),
+			updated.KeySize, updated.KeyVersion, updated.CreatedAt.UTC(), deviceID,
+		)
+
+		return err
+	})
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	return updated, nil
+}
+
+func (r *SQLRepository) UpdatePrivateKey(deviceID uuid.UUID, update func(privateKey []byte) ([]byte, error)) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		device, err := r.lockDevice(tx, deviceID)
+		if err != nil {
+			return err
+		}
+
+		privateKey, err := update(device.PrivateKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE devices SET private_key = %s WHERE id = %s`, r.bind(2)...),
+			blob(privateKey), deviceID)
+
+		return err
+	})
+}
+
+func (r *SQLRepository) RotateKey(deviceID uuid.UUID, rotate RotateFunc) (domain.Device, error) {
+	var updated domain.Device
+
+	err := r.inTx(func(tx *sql.Tx) error {
+		device, err := r.lockDevice(tx, deviceID)
+		if err != nil {
+			return err
+		}
+
+		rotation, err := rotate(device.Device)
+		if err != nil {
+			return err
+		}
+		key := rotation.Key
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE device_keys SET retired_at = %s WHERE device_id = %s AND version = %s`,
+			r.bind(3)...), key.CreatedAt.UTC(), deviceID, device.KeyVersion)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`INSERT INTO device_keys (device_id, version, public_key, created_at) VALUES (%s)`,
+			r.placeholders(1, 4)),
+			deviceID, key.Version, blob(key.PublicKey), key.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE devices SET key_version = %s, public_key = %s, private_key = %s WHERE id = %s`,
+			r.bind(4)...), key.Version, blob(key.PublicKey), blob(rotation.PrivateKey), deviceID)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range rotation.Audit {
+			if err = r.insertAuditRecord(tx, record); err != nil {
+				return err
+			}
+		}
+
+		updated = device.Device
+		updated.KeyVersion = key.Version
+
+		return nil
+	})
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	return updated, nil
+}
+
+func (r *SQLRepository) DeviceKeys(deviceID uuid.UUID) ([]domain.DeviceKey, error) {
+	if err := r.deviceExists(deviceID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`SELECT version, public_key, created_at, retired_at FROM device_keys
+		WHERE device_id = %s ORDER BY version`, r.dialect.placeholder(1)), deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []domain.DeviceKey{}
+	for rows.Next() {
+		key, errScan := scanDeviceKey(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *SQLRepository) ListDeviceKeys(deviceIDs []uuid.UUID) (map[uuid.UUID][]domain.DeviceKey, error) {
+	keys := make(map[uuid.UUID][]domain.DeviceKey, len(deviceIDs))
+	if len(deviceIDs) == 0 {
+		return keys, nil
+	}
+
+	args := make([]interface{}, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		args = append(args, deviceID)
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`SELECT device_id, version, public_key, created_at, retired_at FROM device_keys
+		WHERE device_id IN (%s) ORDER BY device_id, version`, r.placeholders(1, len(deviceIDs))), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deviceID uuid.UUID
+		key, errScan := scanDeviceKey(rows, &deviceID)
+		if errScan != nil {
+			return nil, errScan
+		}
+		keys[deviceID] = append(keys[deviceID], key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *SQLRepository) TransitionDevice(deviceID uuid.UUID, transition TransitionFunc) (domain.Device, error) {
+	var updated domain.Device
+
+	err := r.inTx(func(tx *sql.Tx) error {
+		device, err := r.lockDevice(tx, deviceID)
+		if err != nil {
+			return err
+		}
+
+		updated = device.Device
+		record, err := transition(&updated)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE devices SET status = %s, label = %s WHERE id = %s`, r.bind(3)...),
+			string(updated.Status), updated.Label, deviceID)
+		if err != nil {
+			return err
+		}
+
+		return r.insertTransition(tx, deviceID, record)
+	})
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	return updated, nil
+}
+
+func (r *SQLRepository) insertTransition(tx *sql.Tx, deviceID uuid.UUID, record domain.StatusTransition) error {
+	_, err := tx.Exec(fmt.Sprintf(`INSERT INTO device_status_transitions (device_id, from_status, to_status, reason, at)
+		VALUES (%s)`, r.placeholders(1, 5)),
+		deviceID, string(record.From), string(record.To), record.Reason, record.At.UTC(),
+	)
+
+	return err
+}
+
+func (r *SQLRepository) StatusHistory(deviceID uuid.UUID) ([]domain.StatusTransition, error) {
+	if err := r.deviceExists(deviceID); err != nil {
+		return nil, err
+	}
+
+	return r.statusHistory(r.db, deviceID)
+}
+
+func (r *SQLRepository) statusHistory(q querier, deviceID uuid.UUID) ([]domain.StatusTransition, error) {
+	rows, err := q.Query(fmt.Sprintf(`SELECT from_status, to_status, reason, at FROM device_status_transitions
+		WHERE device_id = %s ORDER BY id`, r.dialect.placeholder(1)), deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []domain.StatusTransition{}
+	for rows.Next() {
+		var transition domain.StatusTransition
+		if err = rows.Scan(&transition.From, &transition.To, &transition.Reason, &transition.At); err != nil {
+			return nil, err
+		}
+		transition.At = transition.At.UTC()
+		history = append(history, transition)
+	}
+
+	return history, rows.Err()
+}
+
+func (r *SQLRepository) AddAuditRecord(record domain.AuditRecord) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		if _, err := r.lockDevice(tx, record.DeviceID); err != nil {
+			return err
+		}
+
+		return r.insertAuditRecord(tx, record)
+	})
+}
+
+func (r *SQLRepository) insertAuditRecord(tx *sql.Tx, record domain.AuditRecord) error {
+	_, err := tx.Exec(fmt.Sprintf(`INSERT INTO device_audit (device_id, action, actor, detail, at) VALUES (%s)`,
+		r.placeholders(1, 5)),
+		record.DeviceID, string(record.Action), record.Actor, record.Detail, record.At.UTC(),
+	)
+
+	return err
+}
+
+func (r *SQLRepository) AuditTrail(deviceID uuid.UUID) ([]domain.AuditRecord, error) {
+	if err := r.deviceExists(deviceID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`SELECT action, actor, detail, at FROM device_audit
+		WHERE device_id = %s ORDER BY id`, r.dialect.placeholder(1)), deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trail := []domain.AuditRecord{}
+	for rows.Next() {
+		record := domain.AuditRecord{DeviceID: deviceID}
+		if err = rows.Scan(&record.Action, &record.Actor, &record.Detail, &record.At); err != nil {
+			return nil, err
+		}
+		record.At = record.At.UTC()
+		trail = append(trail, record)
+	}
+
+	return trail, rows.Err()
+}
+
+func (r *SQLRepository) SignTransaction(deviceID uuid.UUID, sign SignFunc) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		var (
+			counter       int64
+			lastSignature []byte
+		)
+		// the row lock serializes the signatures of the device across all replicas
+		row := tx.QueryRow(fmt.Sprintf(`SELECT %s, signature_counter, last_signature FROM devices WHERE id = %s%s`,
+			deviceColumns, r.dialect.placeholder(1), r.dialect.lockRow), deviceID)
+		device, err := scanDevice(row, &counter, &lastSignature)
+		if err != nil {
+			return err
+		}
+
+		reservation := Reservation{
+			Device:        device,
+			Counter:       counter + 1,
+			LastSignature: lastSignature,
+		}
+
+		entry, err := sign(reservation)
+		if err != nil {
+			return err
+		}
+		entry.Counter = reservation.Counter
+		entry.KeyVersion = device.KeyVersion
+
+		_, err = tx.Exec(fmt.Sprintf(`INSERT INTO signatures (device_id, %s) VALUES (%s)`, signatureColumns, r.placeholders(1, 9)),
+			deviceID, entry.Counter, entry.RawData, blob(entry.RawDataHash), entry.SecuredData, blob(entry.Signature),
+			entry.LastSignature, entry.KeyVersion, entry.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE devices SET signature_counter = %s, last_signature = %s WHERE id = %s`,
+			r.bind(3)...), entry.Counter, blob(entry.Signature), deviceID)
+
+		return err
+	})
+}
+
+func (r *SQLRepository) GetSignatureAndCount(deviceID uuid.UUID) (signature []byte, count int64, err error) {
+	row := r.db.QueryRow(fmt.Sprintf(`SELECT signature_counter, last_signature FROM devices WHERE id = %s`,
+		r.dialect.placeholder(1)), deviceID)
+	if err = row.Scan(&count, &signature); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, initCounter, ErrNotFound
+		}
+		return nil, initCounter, err
+	}
+
+	if count == initCounter {
+		return nil, initCounter, ErrNotFound
+	}
+
+	return signature, count, nil
+}
+
+func (r *SQLRepository) ListSignatures(deviceID uuid.UUID, query domain.JournalQuery) ([]domain.JournalEntry, error) {
+	if err := r.deviceExists(deviceID); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{deviceID, query.From}
+	statement := fmt.Sprintf(`SELECT %s FROM signatures WHERE device_id = %s AND counter >= %s`,
+		signatureColumns, r.dialect.placeholder(1), r.dialect.placeholder(2))
+	if query.To != nil {
+		args = append(args, *query.To)
+		statement += " AND counter <= " + r.dialect.placeholder(len(args))
+	}
+	args = append(args, query.Limit)
+	statement += " ORDER BY counter LIMIT " + r.dialect.placeholder(len(args))
+
+	rows, err := r.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]domain.JournalEntry, 0, query.Limit)
+	for rows.Next() {
+		entry, errScan := scanSignature(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *SQLRepository) GetSignature(deviceID uuid.UUID, counter int64) (domain.JournalEntry, error) {
+	if err := r.deviceExists(deviceID); err != nil {
+		return domain.JournalEntry{}, err
+	}
+
+	row := r.db.QueryRow(fmt.Sprintf(`SELECT %s FROM signatures WHERE device_id = %s AND counter = %s`,
+		signatureColumns, r.dialect.placeholder(1), r.dialect.placeholder(2)), deviceID, counter)
+	entry, err := scanSignature(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.JournalEntry{}, ErrSignatureNotFound
+	}
+
+	return entry, err
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds and rolled back otherwise.
+func (r *SQLRepository) inTx(fn func(tx *sql.Tx) error) error {
+	r.lockWriter()
+	defer r.unlockWriter()
+
+	tx, err := r.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if r.dialect.lockWrite != "" {
+		if _, err = tx.Exec(r.dialect.lockWrite); err != nil {
+			return err
+		}
+	}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// readTx runs fn in a read-only transaction, all its statements read the same snapshot of the database.
+// SQLite ignores the options, a read transaction in WAL mode sees a snapshot anyway.
+func (r *SQLRepository) readTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLRepository) lockWriter() {
+	if r.writer != nil {
+		r.writer.Lock()
+	}
+}
+
+func (r *SQLRepository) unlockWriter() {
+	if r.writer != nil {
+		r.writer.Unlock()
+	}
+}
+
+// lockDevice reads the device and locks its row until the end of the transaction.
+func (r *SQLRepository) lockDevice(tx *sql.Tx, deviceID uuid.UUID) (domain.DeviceKeyPairRaw, error) {
+	row := tx.QueryRow(fmt.Sprintf(`SELECT %s FROM devices WHERE id = %s%s`,
+		deviceColumns, r.dialect.placeholder(1), r.dialect.lockRow), deviceID)
+
+	return scanDevice(row)
+}
+
+func (r *SQLRepository) deviceExists(deviceID uuid.UUID) error {
+	var exists int
+	err := r.db.QueryRow(fmt.Sprintf(`SELECT 1 FROM devices WHERE id = %s`, r.dialect.placeholder(1)), deviceID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// placeholders returns the bind parameters from to to, joined by ", ".
+func (r *SQLRepository) placeholders(from, to int) string {
+	parameters := make([]string, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		parameters = append(parameters, r.dialect.placeholder(n))
+	}
+
+	return strings.Join(parameters, ", ")
+}
+
+// bind returns the first n bind parameters as arguments of fmt.Sprintf.
+func (r *SQLRepository) bind(n int) []interface{} {
+	parameters := make([]interface{}, 0, n)
+	for i := 1; i <= n; i++ {
+		parameters = append(parameters, r.dialect.placeholder(i))
+	}
+
+	return parameters
+}
+
+// blob returns b as a value of a NOT NULL binary column, database/sql would write a nil slice as NULL.
+func blob(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+
+	return b
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDevice reads the deviceColumns of a row followed by extra columns into extra.
+func scanDevice(row rowScanner, extra ...interface{}) (domain.DeviceKeyPairRaw, error) {
+	var (
+		device         domain.DeviceKeyPairRaw
+		algorithm      int
+		encoding       int
+		curve          string
+		keyStorage     string
+		status         string
+		privateKey     []byte
+		startCounter   int64
+		startSignature []byte
+	)
+
+	dest := append([]interface{}{
+		&device.ID, &algorithm, &device.Label, &encoding, &curve, &device.KeySize,
+		&device.KeyVersion, &keyStorage, &status, &device.CreatedAt, &device.PublicKey, &privateKey,
+		&startCounter, &startSignature,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.DeviceKeyPairRaw{}, ErrNotFound
+		}
+		return domain.DeviceKeyPairRaw{}, err
+	}
+
+	device.Algorithm = domain.Algorithm(algorithm)
+	device.Encoding = domain.SignatureEncoding(encoding)
+	device.Curve = domain.Curve(curve)
+	device.KeyStorage = domain.KeyStorage(keyStorage)
+	device.Status = domain.DeviceStatus(status)
+	device.CreatedAt = device.CreatedAt.UTC()
+	device.PrivateKey = privateKey
+	if startCounter != 0 {
+		device.ChainStart = &domain.ChainStart{Counter: startCounter, LastSignature: startSignature}
+	}
+
+	return device, nil
+}
+
+// scanDeviceKey reads leading columns of a row into leading followed by the key version columns.
+func scanDeviceKey(row rowScanner, leading ...interface{}) (domain.DeviceKey, error) {
+	var (
+		key       domain.DeviceKey
+		retiredAt sql.NullTime
+	)
+	dest := append(leading, &key.Version, &key.PublicKey, &key.CreatedAt, &retiredAt)
+	if err := row.Scan(dest...); err != nil {
+		return domain.DeviceKey{}, err
+	}
+
+	key.CreatedAt = key.CreatedAt.UTC()
+	if retiredAt.Valid {
+		at := retiredAt.Time.UTC()
+		key.RetiredAt = &at
+	}
+
+	return key, nil
+}
+
+func scanSignature(row rowScanner) (domain.JournalEntry, error) {
+	var entry domain.JournalEntry
+	err := row.Scan(&entry.Counter, &entry.RawData, &entry.RawDataHash, &entry.SecuredData, &entry.Signature,
+		&entry.LastSignature, &entry.KeyVersion, &entry.CreatedAt)
+	entry.CreatedAt = entry.CreatedAt.UTC()
+
+	return entry, err
+}
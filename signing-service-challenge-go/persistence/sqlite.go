@@ -0,0 +1,59 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	// registers the sqlite driver of database/sql
+	_ "modernc.org/sqlite"
+)
+
+// sqliteOptions opens the database in WAL mode, so reads don't block the writer. The busy timeout comes first,
+// so the switch to WAL mode of a new connection waits for the write lock as well.
+// Times are written as UTC "2006-01-02 15:04:05.999999999-07:00" strings, whose text order is their time order.
+// The driver ignores _txlock next to _time_format, transactions take the write lock with lockWrite instead.
+const sqliteOptions = "_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)" +
+	"&_time_format=sqlite"
+
+var sqlite = sqlDialect{
+	name: "sqlite",
+	placeholder: func(int) string {
+		return "?"
+	},
+	labelKey: `COALESCE(label, '')`,
+	hasPrefix: func(expr, prefix string) string {
+		return fmt.Sprintf("instr(%s, %s) = 1", expr, prefix)
+	},
+	// a deferred transaction that reads before it writes fails with SQLITE_BUSY instead of waiting for a
+	// concurrent writer, a write as first statement waits with the busy timeout and serializes the
+	// transactions like the row lock of PostgreSQL
+	lockWrite: `UPDATE devices SET id = id WHERE 0`,
+}
+
+// OpenSQLite opens the SQLite database file at path, creating it if needed, and migrates its schema.
+// Transactions of all devices are serialized, other processes using the file wait for them with the busy timeout.
+// SQLite has a single writer per database file, it can't lock the row of one device like PostgreSQL: a signature
+// holds the write lock from its first statement to its commit, including the signing of the data. Signatures of
+// different devices queue up behind each other, so the throughput is bounded by one signature at a time, about
+// 1/latency of a signature with the slowest key, e.g. RSA 4096. Use PostgreSQL for concurrent signing of many devices.
+func OpenSQLite(path string, pool PoolConfig) (*SQLRepository, error) {
+	db, err := sql.Open("sqlite", path+"?"+sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+	pool.apply(db)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err = migrate(context.Background(), db, sqlite); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate sqlite schema: %w", err)
+	}
+
+	return &SQLRepository{db: db, dialect: sqlite, writer: &sync.Mutex{}}, nil
+}
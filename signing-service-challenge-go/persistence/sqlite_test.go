@@ -0,0 +1,104 @@
+package persistence_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/repotest"
+)
+
+func TestSQLiteRepository_SurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "signing.db")
+
+	repo, err := persistence.OpenSQLite(path, persistence.PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	label := "store-1"
+	device := domain.DeviceKeyPairRaw{
+		Device: domain.Device{
+			ID:         uuid.New(),
+			Algorithm:  domain.ECDSA,
+			Label:      &label,
+			Curve:      domain.CurveP384,
+			KeyVersion: 1,
+			Status:     domain.StatusActive,
+			CreatedAt:  time.Now().UTC(),
+		},
+		PublicKey:  []byte("public"),
+		PrivateKey: domain.SecretKey("private"),
+	}
+	if _, err = repo.SaveDevice(&device); err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SignTransaction(device.ID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+		return domain.JournalEntry{Signature: []byte("signature-0"), CreatedAt: time.Now().UTC()}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// opening the file again must not apply the migrations twice
+	repo, err = persistence.OpenSQLite(path, persistence.PoolConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	got, err := repo.GetDevice(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Label != label || !got.CreatedAt.Equal(device.CreatedAt) || string(got.PrivateKey) != "private" {
+		t.Fatalf("expected %+v, got %+v", device, got)
+	}
+
+	signature, count, err := repo.GetSignatureAndCount(device.ID)
+	if err != nil || count != 0 || string(signature) != "signature-0" {
+		t.Fatalf("unexpected chain head %q, %d: %v", signature, count, err)
+	}
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	t.Parallel()
+
+	repotest.Run(t, func(t *testing.T) persistence.DeviceSignatureRepository {
+		repo, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "signing.db"), persistence.PoolConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+
+		return repo
+	})
+}
+
+// TestSQLiteRepository_SignTransaction_Replicas signs through two connection pools of the same file, their
+// transactions only wait for each other with the busy timeout.
+func TestSQLiteRepository_SignTransaction_Replicas(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "signing.db")
+	replicas := make([]persistence.DeviceSignatureRepository, 2)
+	for n := range replicas {
+		repo, err := persistence.OpenSQLite(path, persistence.PoolConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		replicas[n] = repo
+	}
+
+	repotest.SignConcurrently(t, replicas...)
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+)
+
+// SignerCache is a bounded LRU cache of parsed signers keyed by device ID.
+// It is safe for concurrent use.
+type SignerCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[uuid.UUID]*list.Element
+}
+
+type cacheEntry struct {
+	deviceID uuid.UUID
+	// privateKey is the key the signer was parsed from, a different key invalidates the entry.
+	privateKey []byte
+	signer     crypto.Signer
+}
+
+// NewSignerCache creates a SignerCache that holds at most capacity signers.
+func NewSignerCache(capacity int) *SignerCache {
+	return &SignerCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[uuid.UUID]*list.Element),
+	}
+}
+
+// Get returns the cached signer of the device if it was parsed from privateKey.
+func (c *SignerCache) Get(deviceID uuid.UUID, privateKey []byte) (crypto.Signer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[deviceID]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !bytes.Equal(entry.privateKey, privateKey) {
+		c.remove(element)
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.signer, true
+}
+
+// Add caches the signer of the device and evicts the least recently used signer if the cache is full.
+func (c *SignerCache) Add(deviceID uuid.UUID, privateKey []byte, signer crypto.Signer) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[deviceID]; ok {
+		c.remove(element)
+	}
+
+	c.entries[deviceID] = c.order.PushFront(&cacheEntry{
+		deviceID:   deviceID,
+		privateKey: privateKey,
+		signer:     signer,
+	})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate removes the signer of the device, it has to be called when the key
+// of a device changes or the device must not sign anymore.
+func (c *SignerCache) Invalidate(deviceID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[deviceID]; ok {
+		c.remove(element)
+	}
+}
+
+// Len returns the number of cached signers.
+func (c *SignerCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *SignerCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).deviceID)
+}
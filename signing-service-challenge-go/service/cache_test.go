@@ -0,0 +1,63 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+type stubSigner struct{}
+
+func (stubSigner) Sign([]byte) ([]byte, error) { return nil, nil }
+
+func TestSignerCache_Eviction(t *testing.T) {
+	t.Parallel()
+
+	cache := service.NewSignerCache(2)
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	key := []byte("key")
+
+	cache.Add(first, key, stubSigner{})
+	cache.Add(second, key, stubSigner{})
+
+	// first becomes the most recently used, so second is evicted
+	if _, ok := cache.Get(first, key); !ok {
+		t.Fatal("expected first to be cached")
+	}
+	cache.Add(third, key, stubSigner{})
+
+	if _, ok := cache.Get(second, key); ok {
+		t.Fatal("expected second to be evicted")
+	}
+	if _, ok := cache.Get(first, key); !ok {
+		t.Fatal("expected first to be cached")
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", cache.Len())
+	}
+}
+
+func TestSignerCache_Invalidation(t *testing.T) {
+	t.Parallel()
+
+	cache := service.NewSignerCache(2)
+	deviceID := uuid.New()
+	var signer crypto.Signer = stubSigner{}
+
+	cache.Add(deviceID, []byte("key"), signer)
+	cache.Invalidate(deviceID)
+	if _, ok := cache.Get(deviceID, []byte("key")); ok {
+		t.Fatal("expected invalidated signer to be removed")
+	}
+
+	cache.Add(deviceID, []byte("key"), signer)
+	if _, ok := cache.Get(deviceID, []byte("rotated key")); ok {
+		t.Fatal("expected signer of a changed key to be removed")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("expected empty cache, got %d entries", cache.Len())
+	}
+}
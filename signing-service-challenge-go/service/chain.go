@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// ChainCheck checks the journal entries of a device one by one in counter order, starting at counter 0,
+// or at the chain start of a device migrated from another system.
+// It is fed from the repository by VerifyChain and from an export file by the verify-chain command.
+type ChainCheck struct {
+	deviceID  uuid.UUID
+	verifiers map[int]crypto.Verifier
+	// data is the transaction data of redacted entries by counter, supplied by the auditor.
+	data map[int64]string
+
+	report        domain.ChainReport
+	start         int64
+	lastSignature []byte
+}
+
+// NewChainCheck returns a check of the chain of the device, verifiers check the signatures of each key version.
+func NewChainCheck(device domain.Device, verifiers map[int]crypto.Verifier) *ChainCheck {
+	start, lastSignature := device.ChainOrigin()
+
+	return &ChainCheck{
+		deviceID:      device.ID,
+		verifiers:     verifiers,
+		start:         start,
+		lastSignature: lastSignature,
+	}
+}
+
+// Add checks the next entry of the journal, it returns false once the chain is broken.
+func (c *ChainCheck) Add(entry domain.JournalEntry) bool {
+	if c.report.FirstBrokenLink != nil {
+		return false
+	}
+
+	if next := c.start + c.report.Entries; entry.Counter != next {
+		return c.broken(next, domain.BreakGap, fmt.Sprintf("expected counter %d, got %d", next, entry.Counter))
+	}
+
+	link := ChainLink(c.deviceID, c.lastSignature)
+	if entry.LastSignature != link {
+		return c.broken(entry.Counter, domain.BreakLink, "last signature isn't the signature of the previous counter")
+	}
+
+	// journals that only keep the hash of the data store the secured data redacted, the data has to be supplied
+	data, securedData := entry.RawData, entry.SecuredData
+	redacted := entry.RawData == "" && entry.SecuredData == RedactSecuredData(entry.Counter, entry.RawDataHash, link)
+	if redacted {
+		supplied, ok := c.data[entry.Counter]
+		if !ok {
+			c.report.UnverifiedSignatures++
+			c.lastSignature = entry.Signature
+			c.report.Entries++
+
+			return true
+		}
+		data, securedData = supplied, SecuredData(entry.Counter, supplied, link)
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	if !bytes.Equal(sum[:], entry.RawDataHash) {
+		return c.broken(entry.Counter, domain.BreakData, "data doesn't match its hash")
+	}
+	if securedData != SecuredData(entry.Counter, data, link) {
+		return c.broken(entry.Counter, domain.BreakData, "secured data doesn't embed the counter, the data and the last signature")
+	}
+	verifier, ok := c.verifiers[entry.KeyVersion]
+	if !ok {
+		return c.broken(entry.Counter, domain.BreakSignature, fmt.Sprintf("unknown key version %d", entry.KeyVersion))
+	}
+	if err := verifier.Verify([]byte(securedData), entry.Signature); err != nil {
+		return c.broken(entry.Counter, domain.BreakSignature, err.Error())
+	}
+	c.report.VerifiedSignatures++
+
+	c.lastSignature = entry.Signature
+	c.report.Entries++
+
+	return true
+}
+
+// Report completes the check, signatureCounter is the number of signatures the device created.
+// Entries missing at the end of the journal break the chain as well.
+func (c *ChainCheck) Report(signatureCounter int64) domain.ChainReport {
+	report := c.report
+	report.SignatureCounter = signatureCounter
+	if report.FirstBrokenLink == nil && c.start+report.Entries < signatureCounter {
+		report.FirstBrokenLink = &domain.ChainBreak{
+			Counter: c.start + report.Entries,
+			Reason:  domain.BreakGap,
+			Detail:  fmt.Sprintf("journal ends before the last counter %d", signatureCounter-1),
+		}
+	}
+	report.Valid = report.FirstBrokenLink == nil
+
+	return report
+}
+
+func (c *ChainCheck) broken(counter int64, reason domain.ChainBreakReason, detail string) bool {
+	c.report.FirstBrokenLink = &domain.ChainBreak{
+		Counter: counter,
+		Reason:  reason,
+		Detail:  detail,
+	}
+
+	return false
+}
+
+// VerifyChain walks the signature journal of the device and reports the first broken link.
+func (v V0Signature) VerifyChain(_ context.Context, deviceID uuid.UUID) (domain.ChainReport, error) {
+	if v.verifiers == nil {
+		return domain.ChainReport{}, ErrVerificationUnavailable
+	}
+
+	d, count, err := v.chainHead(deviceID)
+	if err != nil {
+		return domain.ChainReport{}, err
+	}
+
+	keys, err := v.deviceKeys(deviceID)
+	if err != nil {
+		return domain.ChainReport{}, err
+	}
+	verifiers := make(map[int]crypto.Verifier, len(keys))
+	for _, key := range keys {
+		if verifiers[key.Version], err = v.verifiers.Get(d.Device, key.PublicKey); err != nil {
+			return domain.ChainReport{}, err
+		}
+	}
+
+	check := NewChainCheck(d.Device, verifiers)
+	err = v.walkJournal(deviceID, count, func(entry domain.JournalEntry) bool {
+		return check.Add(entry)
+	})
+	if err != nil {
+		return domain.ChainReport{}, err
+	}
+
+	return check.Report(count), nil
+}
+
+// ExportChain returns the head of the signature chain of the device, so it can be checked offline.
+// The entries aren't loaded, WalkChain streams them.
+func (v V0Signature) ExportChain(_ context.Context, deviceID uuid.UUID) (domain.ChainExport, error) {
+	d, count, err := v.chainHead(deviceID)
+	if err != nil {
+		return domain.ChainExport{}, err
+	}
+
+	keys, err := v.deviceKeys(deviceID)
+	if err != nil {
+		return domain.ChainExport{}, err
+	}
+	publicKeys := make(map[int][]byte, len(keys))
+	for _, key := range keys {
+		publicKey, errParse := crypto.ParsePublicKey(d.Device, key.PublicKey)
+		if errParse != nil {
+			return domain.ChainExport{}, errParse
+		}
+		if publicKeys[key.Version], err = publicKey.PEM(); err != nil {
+			return domain.ChainExport{}, err
+		}
+	}
+
+	return domain.ChainExport{
+		Device:           d.Device,
+		PublicKeys:       publicKeys,
+		SignatureCounter: count,
+	}, nil
+}
+
+// WalkChain calls fn with the journal entries of an export returned by ExportChain in counter order,
+// one page at a time, until fn returns an error.
+func (v V0Signature) WalkChain(ctx context.Context, export domain.ChainExport, fn func(entry domain.JournalEntry) error) error {
+	var errFn error
+	err := v.walkJournal(export.Device.ID, export.SignatureCounter, func(entry domain.JournalEntry) bool {
+		if errFn = ctx.Err(); errFn != nil {
+			return false
+		}
+		errFn = fn(entry)
+
+		return errFn == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return errFn
+}
+
+// VerifyExport checks an exported signature chain, verifiers check the signatures against the exported
+// public key of each key version. data supplies the transaction data by counter for entries of a journal that
+// only keeps the hash of the data, their signatures are only verified with it.
+func VerifyExport(export domain.ChainExport, verifiers map[int]crypto.Verifier, data map[int64]string) domain.ChainReport {
+	check := NewChainCheck(export.Device, verifiers)
+	check.data = data
+	for _, entry := range export.Entries {
+		if !check.Add(entry) {
+			break
+		}
+	}
+
+	return check.Report(export.SignatureCounter)
+}
+
+// chainHead returns the device and the number of signatures it created, read in one repository snapshot.
+func (v V0Signature) chainHead(deviceID uuid.UUID) (domain.DeviceKeyPairRaw, int64, error) {
+	state, err := v.repo.GetDeviceState(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.DeviceKeyPairRaw{}, 0, domain.ErrDeviceNotFound
+		}
+		return domain.DeviceKeyPairRaw{}, 0, err
+	}
+
+	return state.Device, state.Counter + 1, nil
+}
+
+// walkJournal calls fn with the journal entries of the device below count in counter order, until fn returns false.
+func (v V0Signature) walkJournal(deviceID uuid.UUID, count int64, fn func(entry domain.JournalEntry) bool) error {
+	if count == 0 {
+		return nil
+	}
+
+	last := count - 1
+	query := domain.JournalQuery{To: &last, Limit: domain.MaxPageSize}
+	for {
+		entries, err := v.repo.ListSignatures(deviceID, query)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !fn(entry) {
+				return nil
+			}
+		}
+
+		if len(entries) < query.Limit {
+			return nil
+		}
+		query.From = entries[len(entries)-1].Counter + 1
+	}
+}
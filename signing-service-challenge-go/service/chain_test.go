@@ -0,0 +1,209 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+func TestV0Signature_VerifyChain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 5; n++ {
+		if _, err = signature.SignTx(ctx, deviceID, fmt.Sprintf("tx-%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := signature.VerifyChain(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Entries != 5 || report.VerifiedSignatures != 5 || report.FirstBrokenLink != nil {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if _, err = signature.VerifyChain(ctx, uuid.New()); err != domain.ErrDeviceNotFound {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceNotFound, err)
+	}
+}
+
+func TestVerifyExport(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 4; n++ {
+		if _, err = signature.SignTx(ctx, deviceID, fmt.Sprintf("tx-%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export, err := signature.ExportChain(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signature.WalkChain(ctx, export, func(entry domain.JournalEntry) error {
+		export.Entries = append(export.Entries, entry)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := crypto.ParsePEMPublicKey(export.Device, export.PublicKeys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := crypto.NewPublicKeyVerifier(publicKey, crypto.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(export *domain.ChainExport)
+		counter int64
+		reason  domain.ChainBreakReason
+	}{
+		{
+			name:   "intact",
+			tamper: func(export *domain.ChainExport) {},
+		},
+		{
+			name: "missing entry",
+			tamper: func(export *domain.ChainExport) {
+				export.Entries = append(export.Entries[:1:1], export.Entries[2:]...)
+			},
+			counter: 1,
+			reason:  domain.BreakGap,
+		},
+		{
+			name: "missing last entry",
+			tamper: func(export *domain.ChainExport) {
+				export.Entries = export.Entries[:3]
+			},
+			counter: 3,
+			reason:  domain.BreakGap,
+		},
+		{
+			name: "relinked entry",
+			tamper: func(export *domain.ChainExport) {
+				export.Entries[2].LastSignature = export.Entries[0].LastSignature
+			},
+			counter: 2,
+			reason:  domain.BreakLink,
+		},
+		{
+			name: "changed data",
+			tamper: func(export *domain.ChainExport) {
+				export.Entries[1].RawData = "changed"
+			},
+			counter: 1,
+			reason:  domain.BreakData,
+		},
+		{
+			name: "swapped signature",
+			tamper: func(export *domain.ChainExport) {
+				export.Entries[3].Signature = export.Entries[2].Signature
+			},
+			counter: 3,
+			reason:  domain.BreakSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tampered := export
+			tampered.Entries = append([]domain.JournalEntry(nil), export.Entries...)
+			tt.tamper(&tampered)
+
+			report := service.VerifyExport(tampered, map[int]crypto.Verifier{1: verifier}, nil)
+			if tt.reason == "" {
+				if !report.Valid || report.Entries != 4 {
+					t.Fatalf("unexpected report %+v", report)
+				}
+				return
+			}
+
+			broken := report.FirstBrokenLink
+			if report.Valid || broken == nil || broken.Counter != tt.counter || broken.Reason != tt.reason {
+				t.Fatalf("expected a %s break at %d, got %+v", tt.reason, tt.counter, broken)
+			}
+		})
+	}
+}
+
+func TestV0Signature_MigrateDevice(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	lastSignature := []byte("signature of counter 999")
+
+	deviceID, err := signature.MigrateDevice(ctx, domain.DeviceMigration{
+		Device: domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA},
+		Chain:  domain.ChainStart{Counter: 1000, LastSignature: lastSignature},
+		Actor:  "operator",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := signature.SignTx(ctx, deviceID, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := service.SecuredData(1000, "first", service.ChainLink(deviceID, lastSignature)); first.SignedData != want {
+		t.Fatalf("expected the chain to continue with %q, got %q", want, first.SignedData)
+	}
+	if _, err = signature.SignTx(ctx, deviceID, "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := signature.VerifyChain(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Entries != 2 || report.SignatureCounter != 1002 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	trail, err := signature.AuditTrail(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 1 || trail[0].Action != domain.AuditDeviceMigrated || trail[0].Actor != "operator" {
+		t.Fatalf("unexpected audit trail %+v", trail)
+	}
+
+	_, err = signature.MigrateDevice(ctx, domain.DeviceMigration{
+		Device: domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA},
+		Chain:  domain.ChainStart{Counter: 1000},
+	})
+	if err != domain.ErrInvalidChainStart {
+		t.Fatalf("expected %v, got %v", domain.ErrInvalidChainStart, err)
+	}
+	if _, err = signature.AuditTrail(ctx, uuid.New()); err != domain.ErrDeviceNotFound {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceNotFound, err)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// GetDevice returns the device without its keys, together with its signature counter and last signature.
+// They are read at once, so the key fingerprint, the counter and the status belong together.
+func (v V0Signature) GetDevice(_ context.Context, deviceID uuid.UUID) (domain.DeviceDetails, error) {
+	state, err := v.repo.GetDeviceState(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.DeviceDetails{}, domain.ErrDeviceNotFound
+		}
+		return domain.DeviceDetails{}, err
+	}
+	d := state.Device
+
+	publicKey, err := crypto.ParsePublicKey(d.Device, d.PublicKey)
+	if err != nil {
+		return domain.DeviceDetails{}, err
+	}
+
+	fingerprint, err := publicKey.Fingerprint()
+	if err != nil {
+		return domain.DeviceDetails{}, err
+	}
+
+	return domain.DeviceDetails{
+		Device:           d.Device,
+		SignatureCounter: state.Counter + 1,
+		LastSignature:    state.LastSignature,
+		KeyFingerprint:   fingerprint,
+		StatusHistory:    state.History,
+	}, nil
+}
+
+// ListDevices returns a page of devices without their keys.
+func (v V0Signature) ListDevices(_ context.Context, query domain.DeviceQuery) (domain.DevicePage, error) {
+	query.Normalize()
+	if !query.Sort.Valid() {
+		return domain.DevicePage{}, domain.ErrInvalidSort
+	}
+
+	raw, next, err := v.repo.ListDevices(query)
+	if err != nil {
+		return domain.DevicePage{}, err
+	}
+
+	page := domain.DevicePage{
+		Devices:    make([]domain.Device, 0, len(raw)),
+		NextCursor: next,
+	}
+	for _, d := range raw {
+		page.Devices = append(page.Devices, d.Device)
+	}
+
+	return page, nil
+}
+
+// UpdateDevice changes the user controlled fields of the device and moves it through its lifecycle,
+// both in one repository transaction.
+func (v V0Signature) UpdateDevice(_ context.Context, deviceID uuid.UUID, update domain.DeviceUpdate) (domain.Device, error) {
+	if update.Status != nil {
+		return v.transition(deviceID, update)
+	}
+
+	device, err := v.repo.UpdateDevice(deviceID, func(device *domain.Device) error {
+		update.Apply(device)
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.Device{}, domain.ErrDeviceNotFound
+		}
+		return domain.Device{}, err
+	}
+
+	return device, nil
+}
+
+// transition applies the update to the device and moves it to the status of the update, recording the transition.
+// A device that stops being active loses its cached signer.
+func (v V0Signature) transition(deviceID uuid.UUID, update domain.DeviceUpdate) (domain.Device, error) {
+	device, err := v.repo.TransitionDevice(deviceID, func(device *domain.Device) (domain.StatusTransition, error) {
+		update.Apply(device)
+
+		return device.Transition(*update.Status, update.Reason, time.Now().UTC())
+	})
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.Device{}, domain.ErrDeviceNotFound
+		}
+		return domain.Device{}, err
+	}
+
+	if device.Status != domain.StatusActive && v.signers != nil {
+		v.signers.Invalidate(deviceID)
+	}
+
+	return device, nil
+}
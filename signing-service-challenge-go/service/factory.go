@@ -1,15 +1,19 @@
 package service
 
 import (
+	"errors"
+
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 )
 
-type FnAlgorithm = func(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error)
+var ErrAlgorithmNotRegistered = errors.New("algorithm isn't registered")
+
+type FnAlgorithm = func(device domain.Device, privateKey []byte) (crypto.Signer, error)
 
 type AlgorithmFactory interface {
 	Add(algorithm domain.Algorithm, fn FnAlgorithm)
-	Get(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error)
+	Get(device domain.Device, privateKey []byte) (crypto.Signer, error)
 }
 
 type AlgorithmFactoryV0 struct {
@@ -26,6 +30,92 @@ func (a AlgorithmFactoryV0) Add(algorithm domain.Algorithm, fn FnAlgorithm) {
 	a.process[algorithm] = fn
 }
 
-func (a AlgorithmFactoryV0) Get(algorithm domain.Algorithm, privateKey []byte) (crypto.Signer, error) {
-	return a.process[algorithm](algorithm, privateKey)
+func (a AlgorithmFactoryV0) Get(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+	fn, ok := a.process[device.Algorithm]
+	if !ok {
+		return nil, ErrAlgorithmNotRegistered
+	}
+
+	return fn(device, privateKey)
+}
+
+// SealedAlgorithmFactory opens private keys sealed by crypto.SealPrivateKey before passing them to the
+// signers of the wrapped factory. It is the only place the plaintext key of a sealed device exists.
+type SealedAlgorithmFactory struct {
+	AlgorithmFactory
+
+	kek crypto.KeyEncryptionKeyProvider
+}
+
+// NewSealedAlgorithmFactory wraps the factory, so its signers can be created from sealed private keys.
+// Keys stored before encryption was enabled are passed through unchanged.
+func NewSealedAlgorithmFactory(factory AlgorithmFactory, kek crypto.KeyEncryptionKeyProvider) AlgorithmFactory {
+	return &SealedAlgorithmFactory{AlgorithmFactory: factory, kek: kek}
+}
+
+func (a SealedAlgorithmFactory) Get(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+	if !crypto.IsSealedPrivateKey(privateKey) {
+		return a.AlgorithmFactory.Get(device, privateKey)
+	}
+
+	plaintext, err := crypto.OpenPrivateKey(a.kek, device.ID, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	// the signer holds the parsed key, the encoded one isn't needed anymore
+	defer crypto.Wipe(plaintext)
+
+	return a.AlgorithmFactory.Get(device, plaintext)
+}
+
+// KeyStorageAlgorithmFactory creates the signers of devices keeping their private key in a key storage,
+// the stored private key is the reference to it. Other devices are passed to the wrapped factory.
+type KeyStorageAlgorithmFactory struct {
+	AlgorithmFactory
+
+	storage domain.KeyStorage
+	fn      FnAlgorithm
+}
+
+// NewKeyStorageAlgorithmFactory wraps the factory, so fn creates the signers of devices of the key storage.
+func NewKeyStorageAlgorithmFactory(factory AlgorithmFactory, storage domain.KeyStorage, fn FnAlgorithm) AlgorithmFactory {
+	return &KeyStorageAlgorithmFactory{AlgorithmFactory: factory, storage: storage, fn: fn}
+}
+
+func (a KeyStorageAlgorithmFactory) Get(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+	if device.KeyStorage != a.storage {
+		return a.AlgorithmFactory.Get(device, privateKey)
+	}
+
+	return a.fn(device, privateKey)
+}
+
+type FnVerifier = func(device domain.Device, publicKey []byte) (crypto.Verifier, error)
+
+type VerifierFactory interface {
+	Add(algorithm domain.Algorithm, fn FnVerifier)
+	Get(device domain.Device, publicKey []byte) (crypto.Verifier, error)
+}
+
+type VerifierFactoryV0 struct {
+	process map[domain.Algorithm]FnVerifier
+}
+
+func NewVerifierFactoryV0() VerifierFactory {
+	return &VerifierFactoryV0{
+		process: make(map[domain.Algorithm]FnVerifier),
+	}
+}
+
+func (a VerifierFactoryV0) Add(algorithm domain.Algorithm, fn FnVerifier) {
+	a.process[algorithm] = fn
+}
+
+func (a VerifierFactoryV0) Get(device domain.Device, publicKey []byte) (crypto.Verifier, error) {
+	fn, ok := a.process[device.Algorithm]
+	if !ok {
+		return nil, ErrAlgorithmNotRegistered
+	}
+
+	return fn(device, publicKey)
 }
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// JournalData selects how the signature journal keeps the transaction data.
+type JournalData int
+
+const (
+	// JournalRawData keeps the data, its SHA-256 hash and the secured data that was signed.
+	JournalRawData JournalData = iota
+	// JournalDataHash keeps the SHA-256 hash of the data and the secured data redacted by RedactSecuredData,
+	// the data itself isn't stored. The counters and links of the chain can still be checked, the signatures
+	// only if the data is supplied to the check, see VerifyExport.
+	JournalDataHash
+)
+
+// WithJournalData sets how the signature journal keeps the transaction data, JournalRawData by default.
+func WithJournalData(mode JournalData) Option {
+	return func(v *V0Signature) {
+		v.journalData = mode
+	}
+}
+
+// ListSignatures returns a page of the signature journal of the device.
+func (v V0Signature) ListSignatures(_ context.Context, deviceID uuid.UUID, query domain.JournalQuery) (domain.JournalPage, error) {
+	query.Normalize()
+
+	// one more entry than requested tells whether there is a next page
+	limit := query.Limit
+	query.Limit++
+
+	entries, err := v.repo.ListSignatures(deviceID, query)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.JournalPage{}, domain.ErrDeviceNotFound
+		}
+		return domain.JournalPage{}, err
+	}
+
+	page := domain.JournalPage{Entries: entries}
+	if len(entries) > limit {
+		next := entries[limit].Counter
+		page.Entries = entries[:limit]
+		page.NextFrom = &next
+	}
+
+	return page, nil
+}
+
+// GetSignature returns the journal entry of the device with the counter.
+func (v V0Signature) GetSignature(_ context.Context, deviceID uuid.UUID, counter int64) (domain.JournalEntry, error) {
+	entry, err := v.repo.GetSignature(deviceID, counter)
+	if err != nil {
+		if errors.Is(err, persistence.ErrSignatureNotFound) {
+			return domain.JournalEntry{}, domain.ErrSignatureNotFound
+		}
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.JournalEntry{}, domain.ErrDeviceNotFound
+		}
+		return domain.JournalEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// journalEntry keeps the transaction data of the entry as configured by WithJournalData.
+func (v V0Signature) journalEntry(entry domain.JournalEntry, data string) domain.JournalEntry {
+	sum := sha256.Sum256([]byte(data))
+	entry.RawDataHash = sum[:]
+	if v.journalData == JournalDataHash {
+		entry.SecuredData = RedactSecuredData(entry.Counter, entry.RawDataHash, entry.LastSignature)
+		return entry
+	}
+	entry.RawData = data
+
+	return entry
+}
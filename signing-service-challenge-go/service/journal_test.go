@@ -0,0 +1,175 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+func TestV0Signature_ListSignatures(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < 10; n++ {
+		if _, err = signature.SignTx(ctx, deviceID, fmt.Sprintf("tx-%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to := int64(8)
+	query := domain.JournalQuery{From: 2, To: &to, Limit: 3}
+
+	var entries []domain.JournalEntry
+	for {
+		page, errList := signature.ListSignatures(ctx, deviceID, query)
+		if errList != nil {
+			t.Fatal(errList)
+		}
+		entries = append(entries, page.Entries...)
+
+		if page.NextFrom == nil {
+			break
+		}
+		query.From = *page.NextFrom
+	}
+
+	if len(entries) != 7 {
+		t.Fatalf("expected the 7 entries 2..8, got %d", len(entries))
+	}
+	for n, entry := range entries {
+		counter := int64(n + 2)
+		if entry.Counter != counter || entry.RawData != fmt.Sprintf("tx-%d", counter) {
+			t.Fatalf("unexpected entry %+v at %d", entry, counter)
+		}
+		if entry.SecuredData != service.SecuredData(entry.Counter, entry.RawData, entry.LastSignature) {
+			t.Fatalf("unexpected secured data %q", entry.SecuredData)
+		}
+	}
+
+	previous, err := signature.GetSignature(ctx, deviceID, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[3].LastSignature != service.ChainLink(deviceID, previous.Signature) {
+		t.Fatalf("entry 5 isn't linked to entry 4")
+	}
+
+	if _, err = signature.GetSignature(ctx, deviceID, 10); !errors.Is(err, domain.ErrSignatureNotFound) {
+		t.Fatalf("expected %v, got %v", domain.ErrSignatureNotFound, err)
+	}
+	if _, err = signature.GetSignature(ctx, uuid.New(), 0); !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceNotFound, err)
+	}
+}
+
+func TestV0Signature_JournalDataHash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature(service.WithJournalData(service.JournalDataHash))
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[int64]string{0: "secret receipt", 1: "second receipt"}
+	for counter := int64(0); counter < 2; counter++ {
+		if _, err = signature.SignTx(ctx, deviceID, data[counter]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// neither the entry nor its secured data contain the data
+	entry, err := signature.GetSignature(ctx, deviceID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("secret receipt"))
+	if entry.RawData != "" || strings.Contains(entry.SecuredData, "secret") || !bytes.Equal(entry.RawDataHash, sum[:]) ||
+		entry.SecuredData != service.RedactSecuredData(0, sum[:], entry.LastSignature) {
+		t.Fatalf("expected the hash and the redacted secured data without the raw data, got %+v", entry)
+	}
+
+	// without the data the chain is intact, but its signatures can't be verified
+	report, err := signature.VerifyChain(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.VerifiedSignatures != 0 || report.UnverifiedSignatures != 2 {
+		t.Fatalf("expected 2 unverified signatures, got %+v", report)
+	}
+
+	export, err := signature.ExportChain(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signature.WalkChain(ctx, export, func(entry domain.JournalEntry) error {
+		export.Entries = append(export.Entries, entry)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := crypto.ParsePEMPublicKey(export.Device, export.PublicKeys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := crypto.NewPublicKeyVerifier(publicKey, crypto.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiers := map[int]crypto.Verifier{1: verifier}
+
+	// the supplied data verifies the signatures
+	report = service.VerifyExport(export, verifiers, data)
+	if !report.Valid || report.VerifiedSignatures != 2 || report.UnverifiedSignatures != 0 {
+		t.Fatalf("expected both signatures to be verified, got %+v", report)
+	}
+
+	tests := []struct {
+		name   string
+		data   map[int64]string
+		tamper func(entry *domain.JournalEntry)
+		reason domain.ChainBreakReason
+	}{
+		{
+			name:   "wrong data",
+			data:   map[int64]string{0: data[0], 1: "changed"},
+			tamper: func(entry *domain.JournalEntry) {},
+			reason: domain.BreakData,
+		},
+		{
+			name:   "swapped signature",
+			data:   data,
+			tamper: func(entry *domain.JournalEntry) { entry.Signature = export.Entries[0].Signature },
+			reason: domain.BreakSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		tampered := export
+		tampered.Entries = append([]domain.JournalEntry(nil), export.Entries...)
+		tt.tamper(&tampered.Entries[1])
+
+		report := service.VerifyExport(tampered, verifiers, tt.data)
+		if broken := report.FirstBrokenLink; report.Valid || broken == nil || broken.Counter != 1 || broken.Reason != tt.reason {
+			t.Fatalf("%s: expected a %s break at 1, got %+v", tt.name, tt.reason, broken)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+var ErrKeyEncryptionDisabled = errors.New("key encryption isn't configured")
+
+// PublicKey returns the parsed public key of the device.
+func (v V0Signature) PublicKey(_ context.Context, deviceID uuid.UUID) (crypto.PublicKey, error) {
+	d, err := v.repo.GetDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return crypto.PublicKey{}, domain.ErrDeviceNotFound
+		}
+		return crypto.PublicKey{}, err
+	}
+
+	return crypto.ParsePublicKey(d.Device, d.PublicKey)
+}
+
+// JWKS returns the public keys of all active devices as JSON Web Key Set, one key per key version.
+// Retired versions stay published, so signatures created before a rotation can still be verified by their kid.
+func (v V0Signature) JWKS(_ context.Context) (crypto.JWKSet, error) {
+	set := crypto.JWKSet{Keys: []crypto.JWK{}}
+
+	query := domain.DeviceQuery{Status: domain.StatusActive, Limit: domain.MaxPageSize}
+	query.Normalize()
+
+	for {
+		devices, next, err := v.repo.ListDevices(query)
+		if err != nil {
+			return crypto.JWKSet{}, err
+		}
+
+		deviceIDs := make([]uuid.UUID, 0, len(devices))
+		for _, d := range devices {
+			deviceIDs = append(deviceIDs, d.ID)
+		}
+		keys, err := v.repo.ListDeviceKeys(deviceIDs)
+		if err != nil {
+			return crypto.JWKSet{}, err
+		}
+
+		for _, d := range devices {
+			for _, key := range keys[d.ID] {
+				jwk, errJWK := deviceJWK(d.Device, key)
+				if errJWK != nil {
+					return crypto.JWKSet{}, errJWK
+				}
+
+				set.Keys = append(set.Keys, jwk)
+			}
+		}
+
+		if next == "" {
+			return set, nil
+		}
+		query.Cursor = next
+	}
+}
+
+func deviceJWK(device domain.Device, key domain.DeviceKey) (crypto.JWK, error) {
+	publicKey, err := crypto.ParsePublicKey(device, key.PublicKey)
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+
+	jwk, err := publicKey.JWK()
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+	jwk.Kid = domain.KeyID(device.ID, key.Version)
+
+	return jwk, nil
+}
+
+// DeviceKeys returns all key versions of the device, oldest first.
+func (v V0Signature) DeviceKeys(_ context.Context, deviceID uuid.UUID) ([]domain.DeviceKey, error) {
+	return v.deviceKeys(deviceID)
+}
+
+func (v V0Signature) deviceKeys(deviceID uuid.UUID) ([]domain.DeviceKey, error) {
+	keys, err := v.repo.DeviceKeys(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return nil, domain.ErrDeviceNotFound
+		}
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RotateKey replaces the key pair of the device by a new version with the same key parameters. The replaced
+// version doesn't sign anymore, its public key stays available for verification, and the signature chain
+// continues with the new key. The rotation is recorded in the audit trail with actor. A new key that isn't
+// stored, e.g. because the device was rotated concurrently, is destroyed again.
+func (v V0Signature) RotateKey(_ context.Context, deviceID uuid.UUID, actor string) (domain.Device, error) {
+	d, err := v.repo.GetDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.Device{}, domain.ErrDeviceNotFound
+		}
+		return domain.Device{}, err
+	}
+	if !d.Status.CanRotateKey() {
+		return domain.Device{}, domain.ErrKeyRotationNotAllowed
+	}
+
+	keys, err := v.keyPairSource(d.KeyStorage)
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	// the key is generated before the device is locked, generating RSA keys would hold up its signatures
+	next := d.Device
+	next.KeyVersion++
+	public, generated, err := keys.KeyPair(next)
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	device, err := v.rotateKey(next, public, generated, actor)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			err = domain.ErrDeviceNotFound
+		}
+		return domain.Device{}, discardKey(keys, generated, err)
+	}
+
+	if v.signers != nil {
+		v.signers.Invalidate(deviceID)
+	}
+
+	return device, nil
+}
+
+// rotateKey stores the generated key pair as version next.KeyVersion of the device together with its audit record.
+func (v V0Signature) rotateKey(next domain.Device, public, private []byte, actor string) (domain.Device, error) {
+	var err error
+	if v.kek != nil && next.KeyStorage == domain.KeyStorageSoftware {
+		if private, err = sealPrivateKey(v.kek, next.ID, private); err != nil {
+			return domain.Device{}, err
+		}
+	}
+
+	publicKey, err := crypto.ParsePublicKey(next, public)
+	if err != nil {
+		return domain.Device{}, err
+	}
+	fingerprint, err := publicKey.Fingerprint()
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	key := domain.DeviceKey{
+		Version:   next.KeyVersion,
+		PublicKey: public,
+		CreatedAt: time.Now().UTC(),
+	}
+	record := domain.AuditRecord{
+		DeviceID: next.ID,
+		Action:   domain.AuditKeyRotated,
+		Actor:    actor,
+		Detail:   fmt.Sprintf("key version %d replaced version %d, key %s", key.Version, key.Version-1, fingerprint),
+		At:       key.CreatedAt,
+	}
+
+	return v.repo.RotateKey(next.ID, func(device domain.Device) (persistence.KeyRotation, error) {
+		if !device.Status.CanRotateKey() {
+			return persistence.KeyRotation{}, domain.ErrKeyRotationNotAllowed
+		}
+		if device.KeyVersion != key.Version-1 {
+			return persistence.KeyRotation{}, domain.ErrKeyVersionChanged
+		}
+
+		return persistence.KeyRotation{Key: key, PrivateKey: private, Audit: []domain.AuditRecord{record}}, nil
+	})
+}
+
+// RewrapKeys wraps the data keys of all devices with the current master key of the key encryption provider,
+// so replaced master keys can be retired. Private keys stored before encryption was enabled are sealed,
+// devices keeping their key in another key storage are skipped. It returns the number of changed devices and fails without a provider.
+func (v V0Signature) RewrapKeys(_ context.Context) (int, error) {
+	if v.kek == nil {
+		return 0, ErrKeyEncryptionDisabled
+	}
+
+	query := domain.DeviceQuery{Limit: domain.MaxPageSize}
+	query.Normalize()
+
+	rewrapped := 0
+	for {
+		devices, next, err := v.repo.ListDevices(query)
+		if err != nil {
+			return rewrapped, err
+		}
+
+		for _, d := range devices {
+			if d.KeyStorage != domain.KeyStorageSoftware {
+				continue
+			}
+
+			deviceID := d.ID
+			err = v.repo.UpdatePrivateKey(deviceID, func(privateKey []byte) ([]byte, error) {
+				updated, errRewrap := crypto.RewrapPrivateKey(v.kek, deviceID, privateKey)
+				if errRewrap != nil {
+					return nil, fmt.Errorf("device %s: %w", deviceID, errRewrap)
+				}
+				if !bytes.Equal(updated, privateKey) {
+					rewrapped++
+				}
+
+				return updated, nil
+			})
+			if err != nil {
+				return rewrapped, err
+			}
+		}
+
+		if next == "" {
+			return rewrapped, nil
+		}
+		query.Cursor = next
+	}
+}
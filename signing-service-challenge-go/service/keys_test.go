@@ -0,0 +1,370 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto/cryptotest"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+func TestV0Signature_KeyEncryption(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := persistence.NewInMemoryRepository(&sync.RWMutex{})
+	k1, k2 := cryptotest.MasterKey(t), cryptotest.MasterKey(t)
+
+	old, err := crypto.NewLocalKeyProvider("k1", map[string][]byte{"k1": k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := newSignatureWithRepository(repo, service.NewSealedAlgorithmFactory(signerFactory(), old),
+		service.WithKeyEncryption(old))
+
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.GetDevice(deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crypto.IsSealedPrivateKey(stored.PrivateKey) {
+		t.Fatal("private key is stored unencrypted")
+	}
+	if _, err = signature.SignTx(ctx, deviceID, "before rotation"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a device created before encryption was enabled
+	legacy, err := newSignatureWithRepository(repo, signerFactory()).CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := crypto.NewLocalKeyProvider("k2", map[string][]byte{"k1": k1, "k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, err := newSignatureWithRepository(repo, signerFactory(), service.WithKeyEncryption(rotated)).RewrapKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped != 2 {
+		t.Fatalf("expected 2 rewrapped keys, got %d", rewrapped)
+	}
+
+	// k1 is retired, both devices sign with keys wrapped by k2
+	retired, err := crypto.NewLocalKeyProvider("k2", map[string][]byte{"k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature = newSignatureWithRepository(repo, service.NewSealedAlgorithmFactory(signerFactory(), retired),
+		service.WithKeyEncryption(retired))
+
+	for _, id := range []uuid.UUID{deviceID, legacy} {
+		stored, err = repo.GetDevice(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyID, _ := crypto.SealedKeyID(stored.PrivateKey); keyID != "k2" {
+			t.Fatalf("expected master key k2, got %q", keyID)
+		}
+		if _, err = signature.SignTx(ctx, id, "after rotation"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = newSignature().RewrapKeys(ctx); !errors.Is(err, service.ErrKeyEncryptionDisabled) {
+		t.Fatalf("expected %v, got %v", service.ErrKeyEncryptionDisabled, err)
+	}
+}
+
+func TestV0Signature_KeyEncryption_WipesPlaintext(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	provider := cryptotest.KeyProvider(t, "k1", "k1")
+
+	var generated [][]byte
+	keys := crypto.KeyPairSourceFunc(func(device domain.Device) ([]byte, []byte, error) {
+		public, private, err := crypto.GetKeyPair(device)
+		generated = append(generated, private)
+		return public, private, err
+	})
+	signature := newSignatureWithRepository(persistence.NewInMemoryRepository(&sync.RWMutex{}),
+		service.NewSealedAlgorithmFactory(signerFactory(), provider),
+		service.WithKeyEncryption(provider), service.WithKeyPairSource(keys))
+
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signature.RotateKey(ctx, deviceID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signature.SignTx(ctx, deviceID, "data"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(generated) != 2 {
+		t.Fatalf("expected 2 generated keys, got %d", len(generated))
+	}
+	for i, private := range generated {
+		if len(private) == 0 || len(bytes.Trim(private, "\x00")) != 0 {
+			t.Errorf("plaintext of key %d isn't wiped after sealing", i+1)
+		}
+	}
+}
+
+func TestV0Signature_KeyStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := persistence.NewInMemoryRepository(&sync.RWMutex{})
+	provider := cryptotest.KeyProvider(t, "k1", "k1")
+
+	// the fake storage keeps the private keys and hands out their device ID as reference
+	var mu sync.Mutex
+	stored := make(map[string][]byte)
+	keys := crypto.KeyPairSourceFunc(func(device domain.Device) ([]byte, []byte, error) {
+		public, private, err := crypto.GetKeyPair(device)
+		if err != nil {
+			return nil, nil, err
+		}
+		mu.Lock()
+		stored[device.ID.String()] = private
+		mu.Unlock()
+
+		return public, []byte(device.ID.String()), nil
+	})
+	software := signerFactory()
+	factory := service.NewKeyStorageAlgorithmFactory(service.NewSealedAlgorithmFactory(software, provider), domain.KeyStoragePKCS11,
+		func(device domain.Device, ref []byte) (crypto.Signer, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return software.Get(device, stored[string(ref)])
+		})
+
+	_, err := newSignatureWithRepository(repo, factory).CreateDevice(ctx,
+		domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, KeyStorage: domain.KeyStoragePKCS11})
+	if !errors.Is(err, domain.ErrKeyStorageNotAvailable) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyStorageNotAvailable, err)
+	}
+
+	signature := newSignatureWithRepository(repo, factory,
+		service.WithKeyEncryption(provider), service.WithKeyStorage(domain.KeyStoragePKCS11, keys))
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, KeyStorage: domain.KeyStoragePKCS11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := repo.GetDevice(deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.KeyStorage != domain.KeyStoragePKCS11 || string(device.PrivateKey) != deviceID.String() {
+		t.Fatalf("expected the key reference, got %s %q", device.KeyStorage, device.PrivateKey)
+	}
+	if _, err = signature.SignTx(ctx, deviceID, "data"); err != nil {
+		t.Fatal(err)
+	}
+
+	softwareID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signature.SignTx(ctx, softwareID, "data"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reference isn't a sealed key, rotating the master key leaves it alone
+	rewrapped, err := signature.RewrapKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped != 0 {
+		t.Fatalf("expected no rewrapped keys, got %d", rewrapped)
+	}
+}
+
+func TestV0Signature_RotateKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := signature.SignTx(ctx, deviceID, "before")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := signature.RotateKey(ctx, deviceID, "operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.KeyVersion != 2 {
+		t.Fatalf("expected key version 2, got %d", device.KeyVersion)
+	}
+
+	// the cached signer of the retired key doesn't sign anymore
+	after, err := signature.SignTx(ctx, deviceID, "after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.KeyVersion != 1 || after.KeyVersion != 2 {
+		t.Fatalf("expected key versions 1 and 2, got %d and %d", before.KeyVersion, after.KeyVersion)
+	}
+
+	for _, tx := range []domain.SignedTransaction{before, after} {
+		res, errVerify := signature.Verify(ctx, deviceID, tx.SignedData, tx.Signature)
+		if errVerify != nil {
+			t.Fatal(errVerify)
+		}
+		if !res.Valid || res.KeyVersion != tx.KeyVersion {
+			t.Fatalf("expected a valid signature of key version %d, got %+v", tx.KeyVersion, res)
+		}
+	}
+
+	report, err := signature.VerifyChain(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.VerifiedSignatures != 2 {
+		t.Fatalf("expected the chain to continue across the rotation, got %+v", report)
+	}
+
+	set, err := signature.JWKS(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kids := map[string]bool{}
+	for _, jwk := range set.Keys {
+		kids[jwk.Kid] = true
+	}
+	if !kids[domain.KeyID(deviceID, 1)] || !kids[domain.KeyID(deviceID, 2)] {
+		t.Fatalf("expected both key versions in the key set, got %v", kids)
+	}
+
+	trail, err := signature.AuditTrail(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 1 || trail[0].Action != domain.AuditKeyRotated || trail[0].Actor != "operator" {
+		t.Fatalf("unexpected audit trail %+v", trail)
+	}
+
+	decommissioned := domain.StatusDecommissioned
+	if _, err = signature.UpdateDevice(ctx, deviceID, domain.DeviceUpdate{Status: &decommissioned, Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signature.RotateKey(ctx, deviceID, "operator"); !errors.Is(err, domain.ErrKeyRotationNotAllowed) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyRotationNotAllowed, err)
+	}
+
+	// only active devices are published, with all their key versions
+	if set, err = signature.JWKS(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Kid == domain.KeyID(deviceID, 1) || jwk.Kid == domain.KeyID(deviceID, 2) {
+			t.Fatalf("expected no keys of the decommissioned device, got %s", jwk.Kid)
+		}
+	}
+	if _, err = signature.RotateKey(ctx, uuid.New(), "operator"); !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceNotFound, err)
+	}
+}
+
+// destroyingKeys is a key storage that keeps track of the keys it generated and destroyed.
+type destroyingKeys struct {
+	mu        sync.Mutex
+	generated [][]byte
+	destroyed [][]byte
+}
+
+func (k *destroyingKeys) KeyPair(device domain.Device) ([]byte, []byte, error) {
+	public, _, err := crypto.GetKeyPair(device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	ref := []byte(uuid.New().String())
+	k.generated = append(k.generated, ref)
+
+	return public, ref, nil
+}
+
+func (k *destroyingKeys) DestroyKey(ref []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.destroyed = append(k.destroyed, ref)
+
+	return nil
+}
+
+// racingRepository rotates the key of a device right before every rotation, like a concurrent request.
+type racingRepository struct {
+	persistence.DeviceSignatureRepository
+}
+
+func (r racingRepository) RotateKey(deviceID uuid.UUID, rotate persistence.RotateFunc) (domain.Device, error) {
+	_, err := r.DeviceSignatureRepository.RotateKey(deviceID, func(device domain.Device) (persistence.KeyRotation, error) {
+		return persistence.KeyRotation{
+			Key:        domain.DeviceKey{Version: device.KeyVersion + 1, PublicKey: []byte("concurrent"), CreatedAt: time.Now().UTC()},
+			PrivateKey: []byte("concurrent"),
+		}, nil
+	})
+	if err != nil {
+		return domain.Device{}, err
+	}
+
+	return r.DeviceSignatureRepository.RotateKey(deviceID, rotate)
+}
+
+func TestV0Signature_RotateKey_Conflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	keys := &destroyingKeys{}
+	repo := racingRepository{persistence.NewInMemoryRepository(&sync.RWMutex{})}
+	signature := newSignatureWithRepository(repo, signerFactory(), service.WithKeyStorage(domain.KeyStoragePKCS11, keys))
+
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, KeyStorage: domain.KeyStoragePKCS11})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = signature.RotateKey(ctx, deviceID, "operator"); !errors.Is(err, domain.ErrKeyVersionChanged) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyVersionChanged, err)
+	}
+
+	// the key of the lost rotation is destroyed, the key of the device is kept
+	if len(keys.generated) != 2 || len(keys.destroyed) != 1 || !bytes.Equal(keys.destroyed[0], keys.generated[1]) {
+		t.Fatalf("expected the second of the keys %q destroyed, got %q", keys.generated, keys.destroyed)
+	}
+
+	trail, err := signature.AuditTrail(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trail) != 0 {
+		t.Fatalf("expected no audit record of the lost rotation, got %+v", trail)
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// MigrateDevice creates a device that continues the signature chain of a device of another system:
+// its first signature has the counter of the chain start and links to the last signature of the migrated device.
+// The device keeps the private key of the migration, or gets a new one if it's empty. It is stored together
+// with the audit record of the migration and its activation, in one repository transaction.
+func (v V0Signature) MigrateDevice(_ context.Context, migration domain.DeviceMigration) (uuid.UUID, error) {
+	if err := migration.Chain.Validate(); err != nil {
+		return uuid.Nil, err
+	}
+
+	device := migration.Device
+	device.ChainStart = &domain.ChainStart{
+		Counter:       migration.Chain.Counter,
+		LastSignature: append([]byte(nil), migration.Chain.LastSignature...),
+	}
+
+	var (
+		keys crypto.KeyPairSource
+		err  error
+	)
+	imported := len(migration.PrivateKey) > 0
+	if imported {
+		if keys, err = importKeys(&device, migration.PrivateKey, migration.Passphrase); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	return v.createDevice(device, keys, "activated on migration", func(d domain.DeviceKeyPairRaw) ([]domain.AuditRecord, error) {
+		publicKey, errParse := crypto.ParsePublicKey(d.Device, d.PublicKey)
+		if errParse != nil {
+			return nil, errParse
+		}
+		fingerprint, errFingerprint := publicKey.Fingerprint()
+		if errFingerprint != nil {
+			return nil, errFingerprint
+		}
+
+		return []domain.AuditRecord{{
+			DeviceID: d.ID,
+			Action:   domain.AuditDeviceMigrated,
+			Actor:    migration.Actor,
+			Detail: fmt.Sprintf("chain resumed at counter %d after signature %s, key %s (imported: %t)",
+				migration.Chain.Counter, base64.StdEncoding.EncodeToString(migration.Chain.LastSignature), fingerprint, imported),
+			At: d.CreatedAt,
+		}}, nil
+	})
+}
+
+// AuditTrail returns the administrative changes of the device, oldest first.
+func (v V0Signature) AuditTrail(_ context.Context, deviceID uuid.UUID) ([]domain.AuditRecord, error) {
+	trail, err := v.repo.AuditTrail(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return nil, domain.ErrDeviceNotFound
+		}
+		return nil, err
+	}
+
+	return trail, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// SecuredData builds the string that is actually signed for a transaction:
+// <signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>
+func SecuredData(counter int64, data, lastSignature string) string {
+	return fmt.Sprintf("%d_%s_%s", counter, data, lastSignature)
+}
+
+// redactedDataPrefix marks the hash that replaces the data in redacted secured data.
+const redactedDataPrefix = "sha256:"
+
+// RedactSecuredData returns the secured data with the transaction data replaced by its hex encoded SHA-256 hash.
+// Journals that only keep the hash of the data store it instead of the secured data that was signed.
+func RedactSecuredData(counter int64, dataHash []byte, lastSignature string) string {
+	return SecuredData(counter, redactedDataPrefix+hex.EncodeToString(dataHash), lastSignature)
+}
+
+// ChainLink returns the base64 encoded value that links a new signature to the chain.
+// For the first signature of a device there is no last signature, so base64(device.ID) is used instead.
+func ChainLink(deviceID uuid.UUID, lastSignature []byte) string {
+	if len(lastSignature) == 0 {
+		return base64.StdEncoding.EncodeToString([]byte(deviceID.String()))
+	}
+
+	return base64.StdEncoding.EncodeToString(lastSignature)
+}
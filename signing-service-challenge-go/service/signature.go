@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -18,42 +20,306 @@ var (
 
 type Signature interface {
 	CreateDevice(ctx context.Context, device domain.Device) (uuid.UUID, error)
+	ImportDevice(ctx context.Context, device domain.Device, privateKey, passphrase []byte) (uuid.UUID, error)
+	MigrateDevice(ctx context.Context, migration domain.DeviceMigration) (uuid.UUID, error)
+	AuditTrail(ctx context.Context, deviceID uuid.UUID) ([]domain.AuditRecord, error)
+	GetDevice(ctx context.Context, deviceID uuid.UUID) (domain.DeviceDetails, error)
+	ListDevices(ctx context.Context, query domain.DeviceQuery) (domain.DevicePage, error)
+	UpdateDevice(ctx context.Context, deviceID uuid.UUID, update domain.DeviceUpdate) (domain.Device, error)
 	SignTx(ctx context.Context, deviceID uuid.UUID, data string) (domain.SignedTransaction, error)
+	ListSignatures(ctx context.Context, deviceID uuid.UUID, query domain.JournalQuery) (domain.JournalPage, error)
+	GetSignature(ctx context.Context, deviceID uuid.UUID, counter int64) (domain.JournalEntry, error)
+	VerifyChain(ctx context.Context, deviceID uuid.UUID) (domain.ChainReport, error)
+	ExportChain(ctx context.Context, deviceID uuid.UUID) (domain.ChainExport, error)
+	WalkChain(ctx context.Context, export domain.ChainExport, fn func(entry domain.JournalEntry) error) error
+	Verify(ctx context.Context, deviceID uuid.UUID, signedData, signature string) (domain.Verification, error)
+	PublicKey(ctx context.Context, deviceID uuid.UUID) (crypto.PublicKey, error)
+	JWKS(ctx context.Context) (crypto.JWKSet, error)
+	RewrapKeys(ctx context.Context) (int, error)
+	RotateKey(ctx context.Context, deviceID uuid.UUID, actor string) (domain.Device, error)
+	DeviceKeys(ctx context.Context, deviceID uuid.UUID) ([]domain.DeviceKey, error)
 }
 
 type V0Signature struct {
 	repo persistence.DeviceSignatureRepository
 
-	factory AlgorithmFactory
+	factory   AlgorithmFactory
+	verifiers VerifierFactory
+
+	policy  domain.KeyPolicy
+	keys    crypto.KeyPairSource
+	signers *SignerCache
+	kek     crypto.KeyEncryptionKeyProvider
+	// storages generate the keys of devices that don't keep their private key in the repository.
+	storages map[domain.KeyStorage]crypto.KeyPairSource
+
+	journalData JournalData
 }
 
-func NewV0Signature(repo persistence.DeviceSignatureRepository, factory AlgorithmFactory) Signature {
-	return &V0Signature{repo: repo, factory: factory}
+// Option configures optional dependencies of V0Signature.
+type Option func(v *V0Signature)
+
+// WithKeyPairSource sets where the key pairs of new devices come from, crypto.GetKeyPair by default.
+func WithKeyPairSource(keys crypto.KeyPairSource) Option {
+	return func(v *V0Signature) {
+		v.keys = keys
+	}
+}
+
+// WithSignerCache caches the parsed signers of devices, so the private key isn't parsed on every signature.
+func WithSignerCache(cache *SignerCache) Option {
+	return func(v *V0Signature) {
+		v.signers = cache
+	}
+}
+
+// WithVerifierFactory sets the verifiers used to check signatures, Verify fails without them.
+func WithVerifierFactory(verifiers VerifierFactory) Option {
+	return func(v *V0Signature) {
+		v.verifiers = verifiers
+	}
+}
+
+// WithKeyEncryption seals the private keys of new devices with data keys wrapped by the provider.
+// The signer factory has to open them, see NewSealedAlgorithmFactory.
+func WithKeyEncryption(provider crypto.KeyEncryptionKeyProvider) Option {
+	return func(v *V0Signature) {
+		v.kek = provider
+	}
+}
+
+// WithKeyStorage lets devices keep their private key in the key storage, keys generates them there and
+// returns the reference stored in place of the private key. The signer factory has to accept the reference,
+// see NewKeyStorageAlgorithmFactory.
+func WithKeyStorage(storage domain.KeyStorage, keys crypto.KeyPairSource) Option {
+	return func(v *V0Signature) {
+		if v.storages == nil {
+			v.storages = make(map[domain.KeyStorage]crypto.KeyPairSource)
+		}
+		v.storages[storage] = keys
+	}
+}
+
+func NewV0Signature(repo persistence.DeviceSignatureRepository, factory AlgorithmFactory, options ...Option) Signature {
+	v := &V0Signature{
+		repo:    repo,
+		factory: factory,
+		policy:  domain.DefaultKeyPolicy,
+		keys:    crypto.KeyPairSourceFunc(crypto.GetKeyPair),
+	}
+	for _, option := range options {
+		option(v)
+	}
+
+	return v
 }
 
 func (v V0Signature) CreateDevice(_ context.Context, device domain.Device) (uuid.UUID, error) {
-	_, err := v.repo.GetDevice(device.ID)
+	return v.createDevice(device, nil, "activated on creation", nil)
+}
 
-	if !errors.Is(err, persistence.ErrNotFound) {
+// ImportDevice creates a device from an existing PEM encoded private key, see crypto.ImportKeyPair.
+// The key has to match the algorithm and the key parameters of the device, if they are set, and is
+// checked against the key policy like generated keys. Imported keys are kept in the software key storage.
+func (v V0Signature) ImportDevice(_ context.Context, device domain.Device, privateKey, passphrase []byte) (uuid.UUID, error) {
+	keys, err := importKeys(&device, privateKey, passphrase)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return v.createDevice(device, keys, "activated on creation", nil)
+}
+
+// importKeys parses the private key for the device and completes its key parameters,
+// the returned source hands out the imported key pair.
+func importKeys(device *domain.Device, privateKey, passphrase []byte) (crypto.KeyPairSource, error) {
+	if device.KeyStorage != "" && device.KeyStorage != domain.KeyStorageSoftware {
+		return nil, fmt.Errorf("%w: keys can't be imported into %s", domain.ErrKeyStorageNotAvailable, device.KeyStorage)
+	}
+
+	imported, err := crypto.ImportKeyPair(device.Algorithm, privateKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if device.Curve != "" && device.Curve != imported.Curve {
+		return nil, fmt.Errorf("%w: the key is on curve %s", domain.ErrKeyAlgorithmMismatch, imported.Curve)
+	}
+	if device.KeySize != 0 && device.KeySize != imported.KeySize {
+		return nil, fmt.Errorf("%w: the key has %d bits", domain.ErrKeyAlgorithmMismatch, imported.KeySize)
+	}
+	device.Curve = imported.Curve
+	device.KeySize = imported.KeySize
+
+	return crypto.KeyPairSourceFunc(func(domain.Device) ([]byte, []byte, error) {
+		return imported.Public, imported.Private, nil
+	}), nil
+}
+
+// auditFunc returns the audit records of a new device, they are stored together with the device.
+type auditFunc func(device domain.DeviceKeyPairRaw) ([]domain.AuditRecord, error)
+
+// createDevice saves the device with a key pair from keys, or from the key storage of the device if keys is nil.
+// A key pair from keys is an imported one and is checked with the import rules of the key policy.
+// The device is activated with the reason activation unless initialized is requested, audit may be nil.
+func (v V0Signature) createDevice(device domain.Device, keys crypto.KeyPairSource, activation string, audit auditFunc) (uuid.UUID, error) {
+	// duplicates are rejected before a key is generated for them, CreateDevice rejects the ones created since
+	_, err := v.repo.GetDevice(device.ID)
+	if err == nil {
 		return uuid.Nil, domain.ErrDeviceAlreadyExist
 	}
+	if !errors.Is(err, persistence.ErrNotFound) {
+		return uuid.Nil, err
+	}
 
-	pub, private, err := crypto.GetKeyPair(device.Algorithm)
+	apply := v.policy.Apply
+	if keys != nil {
+		// imported keys only have to be strong enough, they aren't limited to the sizes keys are generated with
+		apply = v.policy.ApplyImport
+	}
+	if err = apply(&device); err != nil {
+		return uuid.Nil, err
+	}
+	// devices are created initialized and activated right away, unless initialized is requested
+	activate := device.Status == "" || device.Status == domain.StatusActive
+	if !activate && device.Status != domain.StatusInitialized {
+		return uuid.Nil, domain.ErrInvalidTransition
+	}
+
+	if device.KeyStorage == "" {
+		device.KeyStorage = domain.KeyStorageSoftware
+	}
+	if keys == nil {
+		if keys, err = v.keyPairSource(device.KeyStorage); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	device.KeyVersion = 1
+	device.Status = domain.StatusInitialized
+	device.CreatedAt = time.Now().UTC()
+
+	pub, private, err := keys.KeyPair(device)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	generated := private
+	// keys of other storages never leave them, there is nothing to seal
+	if v.kek != nil && device.KeyStorage == domain.KeyStorageSoftware {
+		if private, err = sealPrivateKey(v.kek, device.ID, private); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	var history []domain.StatusTransition
+	if activate {
+		transition, errActivate := device.Transition(domain.StatusActive, activation, device.CreatedAt)
+		if errActivate != nil {
+			return uuid.Nil, errActivate
+		}
+		history = append(history, transition)
+	}
+
+	creation := persistence.DeviceCreation{
+		Device: &domain.DeviceKeyPairRaw{
+			Device:     device,
+			PublicKey:  pub,
+			PrivateKey: private,
+		},
+		History: history,
+	}
+	if audit != nil {
+		if creation.Audit, err = audit(*creation.Device); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	// the device is stored active together with its activation and audit trail, never initialized in between
+	id, err := v.repo.CreateDevice(creation)
+	if err != nil {
+		// another request created the device since the check above
+		if errors.Is(err, persistence.ErrAlreadyExists) {
+			err = domain.ErrDeviceAlreadyExist
+		}
+		return uuid.Nil, discardKey(keys, generated, err)
+	}
+
+	return id, nil
+}
+
+// sealPrivateKey seals the plaintext private key of a software device and wipes the plaintext afterwards, also
+// when sealing fails. Software keys aren't kept by their source, discardKey doesn't need the plaintext anymore.
+func sealPrivateKey(kek crypto.KeyEncryptionKeyProvider, deviceID uuid.UUID, private []byte) ([]byte, error) {
+	defer crypto.Wipe(private)
+	return crypto.SealPrivateKey(kek, deviceID, private)
+}
+
+// discardKey destroys a generated key that wasn't stored with a device if keys keeps it, e.g. on a PKCS#11 token,
+// and returns err. A key that couldn't be destroyed is reported together with err.
+func discardKey(keys crypto.KeyPairSource, private []byte, err error) error {
+	destroyer, ok := keys.(crypto.KeyDestroyer)
+	if !ok {
+		return err
+	}
+	if errDestroy := destroyer.DestroyKey(private); errDestroy != nil {
+		return fmt.Errorf("%w, the unused key couldn't be destroyed: %v", err, errDestroy)
+	}
+
+	return err
+}
+
+// keyPairSource returns where the keys of devices with the key storage are generated.
+func (v V0Signature) keyPairSource(storage domain.KeyStorage) (crypto.KeyPairSource, error) {
+	if storage == domain.KeyStorageSoftware {
+		return v.keys, nil
+	}
 
-	deviceRaw := domain.DeviceKeyPairRaw{
-		Device:     device,
-		PublicKey:  pub,
-		PrivateKey: private,
+	keys, ok := v.storages[storage]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrKeyStorageNotAvailable, storage)
 	}
 
-	return v.repo.SaveDevice(&deviceRaw)
+	return keys, nil
 }
 
 func (v V0Signature) SignTx(_ context.Context, deviceID uuid.UUID, data string) (domain.SignedTransaction, error) {
-	d, err := v.repo.GetDevice(deviceID)
+	var signed domain.SignedTransaction
+
+	err := v.repo.SignTransaction(deviceID, func(reservation persistence.Reservation) (domain.JournalEntry, error) {
+		if reservation.Device.Status != domain.StatusActive {
+			return domain.JournalEntry{}, domain.ErrDeviceNotActive
+		}
+
+		signer, err := v.signer(reservation.Device)
+		if err != nil {
+			return domain.JournalEntry{}, err
+		}
+
+		lastSignature := ChainLink(deviceID, reservation.LastSignature)
+		securedData := SecuredData(reservation.Counter, data, lastSignature)
+
+		signature, err := signer.Sign([]byte(securedData))
+		if err != nil {
+			return domain.JournalEntry{}, err
+		}
+
+		signed = domain.SignedTransaction{
+			Signature:     base64.StdEncoding.EncodeToString(signature),
+			Counter:       reservation.Counter,
+			RawData:       data,
+			LastSignature: lastSignature,
+			SignedData:    securedData,
+			KeyVersion:    reservation.Device.KeyVersion,
+		}
+
+		return v.journalEntry(domain.JournalEntry{
+			Counter:       reservation.Counter,
+			SecuredData:   securedData,
+			Signature:     signature,
+			LastSignature: lastSignature,
+			KeyVersion:    reservation.Device.KeyVersion,
+			CreatedAt:     time.Now().UTC(),
+		}, data), nil
+	})
 	if err != nil {
 		if errors.Is(err, persistence.ErrNotFound) {
 			return emptySigned, domain.ErrDeviceNotFound
@@ -61,25 +327,25 @@ func (v V0Signature) SignTx(_ context.Context, deviceID uuid.UUID, data string)
 		return emptySigned, err
 	}
 
-	signer, err := v.factory.Get(d.Algorithm, d.PrivateKey)
-	if err != nil {
-		return emptySigned, err
+	return signed, nil
+}
+
+// signer returns the signer of the device, from the cache if there is one.
+func (v V0Signature) signer(device domain.DeviceKeyPairRaw) (crypto.Signer, error) {
+	if v.signers == nil {
+		return v.factory.Get(device.Device, device.PrivateKey)
 	}
 
-	signed, err := signer.Sign([]byte(data))
-	if err != nil {
-		return emptySigned, err
+	if signer, ok := v.signers.Get(device.ID, device.PrivateKey); ok {
+		return signer, nil
 	}
 
-	prev, counter, err := v.repo.GetAndSaveSignature(deviceID, signed)
+	signer, err := v.factory.Get(device.Device, device.PrivateKey)
 	if err != nil {
-		return emptySigned, err
+		return nil, err
 	}
 
-	return domain.SignedTransaction{
-		Signature:     base64.StdEncoding.EncodeToString(signed),
-		Counter:       counter,
-		RawData:       data,
-		LastSignature: base64.StdEncoding.EncodeToString(prev),
-	}, nil
+	v.signers.Add(device.ID, device.PrivateKey, signer)
+
+	return signer, nil
 }
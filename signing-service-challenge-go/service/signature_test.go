@@ -0,0 +1,373 @@
+package service_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/service"
+)
+
+func TestV0Signature_SignTx_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	const signatures = 100
+
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(context.Background(), domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		txs = make([]domain.SignedTransaction, 0, signatures)
+	)
+
+	for n := 0; n < signatures; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			tx, errSign := signature.SignTx(context.Background(), deviceID, "data")
+			if errSign != nil {
+				t.Error(errSign)
+				return
+			}
+
+			mu.Lock()
+			txs = append(txs, tx)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(txs) != signatures {
+		t.Fatalf("expected %d signatures, got %d", signatures, len(txs))
+	}
+
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Counter < txs[j].Counter })
+
+	lastSignature := base64.StdEncoding.EncodeToString([]byte(deviceID.String()))
+	for n, tx := range txs {
+		if tx.Counter != int64(n) {
+			t.Fatalf("expected counter %d, got %d", n, tx.Counter)
+		}
+		if tx.LastSignature != lastSignature {
+			t.Fatalf("counter %d isn't linked to the previous signature", tx.Counter)
+		}
+		if tx.SignedData != service.SecuredData(tx.Counter, "data", lastSignature) {
+			t.Fatalf("unexpected signed data %q", tx.SignedData)
+		}
+		lastSignature = tx.Signature
+	}
+}
+
+func TestV0Signature_Verify(t *testing.T) {
+	t.Parallel()
+
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(context.Background(), domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := signature.SignTx(context.Background(), deviceID, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := signature.Verify(context.Background(), deviceID, tx.SignedData, tx.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid {
+		t.Fatalf("expected a valid signature, got %q", res.Reason)
+	}
+
+	res, err = signature.Verify(context.Background(), deviceID, tx.SignedData+"_", tx.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Valid || res.Reason == "" {
+		t.Fatalf("expected an invalid signature with a reason, got %+v", res)
+	}
+}
+
+func TestV0Signature_ImportDevice(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	signature := newSignature()
+	deviceID, err := signature.ImportDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA}, privateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := signature.GetDevice(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Curve != domain.CurveP256 || device.Status != domain.StatusActive {
+		t.Fatalf("unexpected device %+v", device.Device)
+	}
+
+	// the device signs with the imported key
+	tx, err := signature.SignTx(ctx, deviceID, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := base64.StdEncoding.DecodeString(tx.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(tx.SignedData))
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signed) {
+		t.Fatal("signature doesn't verify with the imported key")
+	}
+
+	// the key parameters of the device have to match the key
+	_, err = signature.ImportDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, Curve: domain.CurveP384}, privateKey, nil)
+	if !errors.Is(err, domain.ErrKeyAlgorithmMismatch) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyAlgorithmMismatch, err)
+	}
+
+	// keys below the key policy are rejected
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weak)})
+	_, err = signature.ImportDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.RSAPKCS1SHA256}, weakKey, nil)
+	if !errors.Is(err, domain.ErrKeyParamsNotAllowed) {
+		t.Fatalf("expected %v, got %v", domain.ErrKeyParamsNotAllowed, err)
+	}
+
+	// keys of sizes that aren't generated are imported as long as they meet the minimum strength
+	legacy, err := rsa.GenerateKey(rand.Reader, 2560)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(legacy)})
+	legacyID, err := signature.ImportDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.RSAPSSSHA256}, legacyKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device, err = signature.GetDevice(ctx, legacyID); err != nil || device.KeySize != 2560 {
+		t.Fatalf("expected a device with a 2560 bit key, got %+v, %v", device.Device, err)
+	}
+
+	if _, err = signature.ImportDevice(ctx, domain.Device{ID: deviceID, Algorithm: domain.ECDSA}, privateKey, nil); !errors.Is(err, domain.ErrDeviceAlreadyExist) {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceAlreadyExist, err)
+	}
+}
+
+func TestV0Signature_SignTx_NotFound(t *testing.T) {
+	t.Parallel()
+
+	_, err := newSignature().SignTx(context.Background(), uuid.New(), "data")
+	if err != domain.ErrDeviceNotFound {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceNotFound, err)
+	}
+}
+
+// unavailableRepository fails every device lookup, like a database that can't be reached.
+type unavailableRepository struct {
+	persistence.DeviceSignatureRepository
+}
+
+var errUnavailable = errors.New("connection refused")
+
+func (unavailableRepository) GetDevice(uuid.UUID) (domain.DeviceKeyPairRaw, error) {
+	return domain.DeviceKeyPairRaw{}, errUnavailable
+}
+
+func TestV0Signature_CreateDevice_RepositoryError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = signature.CreateDevice(ctx, domain.Device{ID: deviceID, Algorithm: domain.ECDSA}); !errors.Is(err, domain.ErrDeviceAlreadyExist) {
+		t.Fatalf("expected %v, got %v", domain.ErrDeviceAlreadyExist, err)
+	}
+
+	// a failing repository isn't reported as a duplicate device
+	unavailable := newSignatureWithRepository(unavailableRepository{persistence.NewInMemoryRepository(&sync.RWMutex{})}, signerFactory())
+	if _, err = unavailable.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA}); !errors.Is(err, errUnavailable) {
+		t.Fatalf("expected %v, got %v", errUnavailable, err)
+	}
+}
+
+func newSignature(options ...service.Option) service.Signature {
+	return newSignatureWithRepository(persistence.NewInMemoryRepository(&sync.RWMutex{}), signerFactory(), options...)
+}
+
+func newSignatureWithRepository(repo persistence.DeviceSignatureRepository, factory service.AlgorithmFactory, options ...service.Option) service.Signature {
+	verifiers := service.NewVerifierFactoryV0()
+	verifiers.Add(domain.ECDSA, func(device domain.Device, publicKey []byte) (crypto.Verifier, error) {
+		keyPair, err := crypto.NewECCMarshaller().UnMarshalPublic(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.NewECCVerifier(keyPair.(*crypto.ECCKeyPair), crypto.Config{}), nil
+	})
+
+	options = append([]service.Option{
+		service.WithVerifierFactory(verifiers),
+		service.WithSignerCache(service.NewSignerCache(16)),
+	}, options...)
+
+	return service.NewV0Signature(repo, factory, options...)
+}
+
+// signerFactory creates ECDSA signers with the default config.
+func signerFactory() service.AlgorithmFactory {
+	factory := service.NewAlgorithmFactoryV0()
+	factory.Add(domain.ECDSA, func(device domain.Device, privateKey []byte) (crypto.Signer, error) {
+		keyPair, err := crypto.NewECCMarshaller().UnMarshal(privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return crypto.NewECCSigner(keyPair.(*crypto.ECCKeyPair), crypto.Config{}), nil
+	})
+
+	return factory
+}
+
+func TestV0Signature_ListDevices(t *testing.T) {
+	t.Parallel()
+
+	signature := newSignature()
+	for n := 0; n < 25; n++ {
+		label := fmt.Sprintf("store-%02d", n)
+		if n%5 == 0 {
+			label = fmt.Sprintf("office-%02d", n)
+		}
+
+		_, err := signature.CreateDevice(context.Background(), domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, Label: &label})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		labels []string
+		query  = domain.DeviceQuery{LabelPrefix: "store-", Sort: domain.SortLabelDesc, Limit: 7}
+	)
+	for pages := 1; ; pages++ {
+		page, err := signature.ListDevices(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, device := range page.Devices {
+			labels = append(labels, *device.Label)
+		}
+
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Fatalf("expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if len(labels) != 20 {
+		t.Fatalf("expected 20 devices, got %d", len(labels))
+	}
+	if !sort.SliceIsSorted(labels, func(i, j int) bool { return labels[i] > labels[j] }) {
+		t.Fatalf("expected descending labels, got %v", labels)
+	}
+
+	query.Sort = domain.SortCreatedAtAsc
+	if _, err := signature.ListDevices(context.Background(), query); err != domain.ErrInvalidCursor {
+		t.Fatalf("expected %v for a cursor of another order, got %v", domain.ErrInvalidCursor, err)
+	}
+}
+
+func TestV0Signature_Lifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	signature := newSignature()
+	deviceID, err := signature.CreateDevice(ctx, domain.Device{ID: uuid.New(), Algorithm: domain.ECDSA, Status: domain.StatusInitialized})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = signature.SignTx(ctx, deviceID, "data"); !errors.Is(err, domain.ErrDeviceNotActive) {
+		t.Fatalf("expected %v for an initialized device, got %v", domain.ErrDeviceNotActive, err)
+	}
+
+	steps := []struct {
+		status  domain.DeviceStatus
+		signErr error
+	}{
+		{status: domain.StatusActive},
+		{status: domain.StatusSuspended, signErr: domain.ErrDeviceNotActive},
+		{status: domain.StatusActive},
+		{status: domain.StatusDecommissioned, signErr: domain.ErrDeviceNotActive},
+	}
+	for _, step := range steps {
+		status := step.status
+		if _, err = signature.UpdateDevice(ctx, deviceID, domain.DeviceUpdate{Status: &status, Reason: "test"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = signature.SignTx(ctx, deviceID, "data"); !errors.Is(err, step.signErr) {
+			t.Fatalf("expected %v for a %s device, got %v", step.signErr, status, err)
+		}
+	}
+
+	// the rejected transition leaves the label of the same update unchanged
+	reactivate := domain.StatusActive
+	label := "reactivated"
+	_, err = signature.UpdateDevice(ctx, deviceID, domain.DeviceUpdate{Label: &label, Status: &reactivate, Reason: "test"})
+	if !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Fatalf("expected %v for a decommissioned device, got %v", domain.ErrInvalidTransition, err)
+	}
+
+	details, err := signature.GetDevice(ctx, deviceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Status != domain.StatusDecommissioned || details.Label != nil || details.SignatureCounter != 2 ||
+		len(details.StatusHistory) != len(steps) {
+		t.Fatalf("unexpected details %+v", details)
+	}
+	if first := details.StatusHistory[0]; first.From != domain.StatusInitialized || first.To != domain.StatusActive {
+		t.Fatalf("unexpected first transition %+v", first)
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+var ErrVerificationUnavailable = errors.New("no verifiers configured")
+
+// Verify checks that signature is the base64 encoded signature of signedData created by the device.
+// An invalid signature isn't an error, the returned Verification holds the reason.
+func (v V0Signature) Verify(_ context.Context, deviceID uuid.UUID, signedData, signature string) (domain.Verification, error) {
+	if v.verifiers == nil {
+		return domain.Verification{}, ErrVerificationUnavailable
+	}
+
+	d, err := v.repo.GetDevice(deviceID)
+	if err != nil {
+		if errors.Is(err, persistence.ErrNotFound) {
+			return domain.Verification{}, domain.ErrDeviceNotFound
+		}
+		return domain.Verification{}, err
+	}
+
+	rawSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return domain.Verification{Reason: "signature isn't base64 encoded"}, nil
+	}
+
+	keys, err := v.deviceKeys(deviceID)
+	if err != nil {
+		return domain.Verification{}, err
+	}
+
+	// signatures of retired key versions stay valid, the current version is the most likely to match
+	var reason string
+	for n := len(keys) - 1; n >= 0; n-- {
+		verifier, errVerifier := v.verifiers.Get(d.Device, keys[n].PublicKey)
+		if errVerifier != nil {
+			return domain.Verification{}, errVerifier
+		}
+
+		errVerify := verifier.Verify([]byte(signedData), rawSignature)
+		if errVerify == nil {
+			return domain.Verification{Valid: true, KeyVersion: keys[n].Version}, nil
+		}
+		if reason == "" {
+			reason = errVerify.Error()
+		}
+	}
+
+	return domain.Verification{Reason: reason}, nil
+}